@@ -0,0 +1,30 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin only lets requests that change data through with the admin
+// token as a bearer token. Reads stay public. Without an admin token
+// configured changes are refused
+func (a *API) requireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			handler(w, r)
+			return
+		}
+		if a.adminToken == "" {
+			a.writeError(w, http.StatusForbidden, "changes are disabled, API_ADMIN_TOKEN is not set")
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			a.writeError(w, http.StatusUnauthorized, "admin token required")
+			return
+		}
+		handler(w, r)
+	}
+}
@@ -0,0 +1,202 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type Config struct {
+	DatabaseDSN   string `envconfig:"DATABASE_DSN" required:"true" validate:"dsn" secret:"true"`
+	ListenAddress string `envconfig:"API_LISTEN_ADDRESS" required:"true"`
+	AdminToken    string `envconfig:"API_ADMIN_TOKEN" required:"false" secret:"true"`
+}
+
+// API serves the computed Droplet data over HTTP
+type API struct {
+	logger *logrus.Entry
+	db     *gorm.DB
+	server *http.Server
+
+	// adminToken authorizes the requests that change data
+	adminToken string
+
+	rankIndexes rankIndexCache
+
+	healthy Check
+	ready   Check
+
+	balanceLookup BalanceLookup
+}
+
+// New returns a new instance of the API and returns an error if there was a
+// problem setting it up
+func New(
+	log *logrus.Entry) (*API, error) {
+
+	// Parse config environment variables for self
+	var config Config
+	err := envconfig.Process("", &config)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := gorm.Open(postgres.Open(config.DatabaseDSN), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	api := &API{
+		logger:     log,
+		db:         db,
+		adminToken: config.AdminToken,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/leaderboard", api.handleLeaderboard)
+	mux.HandleFunc("/v1/movers", api.handleMovers)
+	mux.HandleFunc("/v1/labels", api.handleLabels)
+	mux.HandleFunc("/v1/entities", api.requireAdmin(api.handleEntities))
+	mux.HandleFunc("/v1/entities/entity", api.requireAdmin(api.handleEntity))
+	mux.HandleFunc("/v1/entities/leaderboard", api.handleEntityLeaderboard)
+	mux.HandleFunc("/v1/address/resolve", api.handleResolveAddress)
+	mux.HandleFunc("/v1/address/history", api.handleAddressHistory)
+	mux.HandleFunc("/v1/address/projection", api.handleAddressProjection)
+	mux.HandleFunc("/v1/address/positions", api.handleAddressPositions)
+	mux.HandleFunc("/v1/address/balance", api.handleAddressBalance)
+	mux.HandleFunc("/v1/positions/flagged", api.handleFlaggedPositions)
+	mux.HandleFunc("/v1/stats/distribution", api.handleDistributionHistory)
+	mux.HandleFunc("/v1/rank/threshold", api.handleRankThreshold)
+	mux.HandleFunc("/v1/rank/for", api.handleRankFor)
+	mux.HandleFunc("/v1/rank/tiers", api.handleRankTiers)
+	mux.HandleFunc("/v1/stats/statuses", api.handleStatusHistory)
+	mux.HandleFunc("/v1/stats/statuses/addresses", api.handleStatusAddresses)
+	mux.HandleFunc("/v1/cohorts", api.handleCohorts)
+	mux.HandleFunc("/v1/stats", api.handleStatsHistory)
+	mux.HandleFunc("/v1/stats/exclusions", api.handleExclusions)
+	mux.HandleFunc("/v1/skiplist", api.requireAdmin(api.handleSkiplist))
+	mux.HandleFunc("/v1/quarantine/keys", api.handleQuarantinedKeys)
+	mux.HandleFunc("/v1/quarantine/snapshots", api.requireAdmin(api.handleQuarantinedSnapshots))
+	mux.HandleFunc("/v1/runs", api.handleRuns)
+	mux.HandleFunc("/v1/runs/latest", api.handleLatestRuns)
+	mux.HandleFunc("/v1/export", api.handleExport)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/healthz", api.handleHealthz)
+	mux.HandleFunc("/readyz", api.handleReadyz)
+
+	api.server = &http.Server{
+		Addr:              config.ListenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+
+	return api, nil
+}
+
+// Run serves the API until it is stopped
+func (a *API) Run() error {
+	a.logger.WithFields(logrus.Fields{
+		"address": a.server.Addr,
+	}).Info("Starting API")
+
+	err := a.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Stop the API, waiting for in-flight requests to complete
+func (a *API) Stop() error {
+	a.logger.Info("Stopping API")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	return a.server.Shutdown(ctx)
+}
+
+var (
+	errInvalidLimit  = errors.New("limit must be between 1 and 1000")
+	errInvalidOffset = errors.New("offset must be a positive integer")
+)
+
+// errorResponse is the body returned for any failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes value as the JSON response body with the given status
+func (a *API) writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	err := json.NewEncoder(w).Encode(value)
+	if err != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Warning("Unable to write response")
+	}
+}
+
+// writeError writes a JSON error response with the given status
+func (a *API) writeError(w http.ResponseWriter, status int, message string) {
+	a.writeJSON(w, status, errorResponse{Error: message})
+}
+
+// parseDate parses a date given as either YYYY-MM-DD or RFC3339
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("missing date")
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err == nil {
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// heightParam returns the height query parameter, or zero if it isn't set
+func (a *API) heightParam(r *http.Request) (int64, error) {
+	value := r.URL.Query().Get("height")
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// addressParam resolves the address query parameter to a Neutron address,
+// writing the error response if it can't
+func (a *API) addressParam(w http.ResponseWriter, r *http.Request) (indexer.ResolvedAddress, bool) {
+	input := r.URL.Query().Get("address")
+	if input == "" {
+		a.writeError(w, http.StatusBadRequest, "address is required")
+		return indexer.ResolvedAddress{}, false
+	}
+	resolved, err := indexer.ResolveAddress(input)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return indexer.ResolvedAddress{}, false
+	}
+	return resolved, true
+}
+
+// handleResolveAddress returns the Neutron address a lookup address
+// resolves to
+func (a *API) handleResolveAddress(w http.ResponseWriter, r *http.Request) {
+	resolved, ok := a.addressParam(w, r)
+	if !ok {
+		return
+	}
+	a.writeJSON(w, http.StatusOK, resolved)
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer"
+	"github.com/sirupsen/logrus"
+)
+
+// BalanceLookup looks up the on-chain balance of an address at a height and
+// compares it with the stored one
+type BalanceLookup func(ctx context.Context, address string, height int64, lookup string) (indexer.BalanceCheck, error)
+
+// SetBalanceLookup sets the on-chain balance lookup of the indexer, the API
+// doesn't query the chain itself
+func (a *API) SetBalanceLookup(lookup BalanceLookup) {
+	a.balanceLookup = lookup
+}
+
+// handleAddressBalance returns the on-chain balance of an address at a
+// height, the latest captured snapshot by default, compared with the balance
+// stored for that snapshot
+func (a *API) handleAddressBalance(w http.ResponseWriter, r *http.Request) {
+	if a.balanceLookup == nil {
+		a.writeError(w, http.StatusServiceUnavailable, "balance lookups are not available")
+		return
+	}
+	resolved, ok := a.addressParam(w, r)
+	if !ok {
+		return
+	}
+	height, err := a.heightParam(r)
+	if err != nil || height < 0 {
+		a.writeError(w, http.StatusBadRequest, "height must be a positive integer")
+		return
+	}
+	lookup := r.URL.Query().Get("lookup")
+	if lookup == "" {
+		lookup = indexer.LookupSmart
+	}
+	if lookup != indexer.LookupSmart && lookup != indexer.LookupRaw {
+		a.writeError(w, http.StatusBadRequest, "lookup must be smart or raw")
+		return
+	}
+
+	check, err := a.balanceLookup(r.Context(), resolved.Address, height, lookup)
+	if err != nil {
+		a.logger.WithFields(logrus.Fields{
+			"address": resolved.Address,
+			"height":  height,
+			"err":     err,
+		}).Error("Unable to check balance")
+		a.writeError(w, http.StatusBadGateway, "unable to check balance: "+err.Error())
+		return
+	}
+	// Keep the address as it was asked for
+	check.Address = resolved
+	a.writeJSON(w, http.StatusOK, check)
+}
@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// CohortMatrix is a cohort metric laid out for a heatmap. Values[c][h] is the
+// metric of cohort Cohorts[c] at snapshot Heights[h], or null before the
+// cohort started
+type CohortMatrix struct {
+	Metric  string       `json:"metric"`
+	Cohorts []int64      `json:"cohorts"`
+	Heights []int64      `json:"heights"`
+	Values  [][]*float64 `json:"values"`
+}
+
+// cohortMetrics maps the supported metrics to their value in a cohort row
+var cohortMetrics = map[string]func(models.DropletCohort) float64{
+	"retention":      func(cohort models.DropletCohort) float64 { return cohort.Retention },
+	"retained":       func(cohort models.DropletCohort) float64 { return float64(cohort.Retained) },
+	"median_balance": func(cohort models.DropletCohort) float64 { return float64(cohort.MedianBalance) },
+	"droplet_share":  func(cohort models.DropletCohort) float64 { return cohort.DropletShare },
+}
+
+// handleCohorts returns a cohort metric as a matrix of cohorts by snapshot
+func (a *API) handleCohorts(w http.ResponseWriter, r *http.Request) {
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		metric = "retention"
+	}
+	value, ok := cohortMetrics[metric]
+	if !ok {
+		a.writeError(w, http.StatusBadRequest, "metric must be one of retention, retained, median_balance or droplet_share")
+		return
+	}
+
+	var cohorts []models.DropletCohort
+	result := a.db.Order("cohort_height ASC, height ASC").Find(&cohorts)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch cohorts")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch cohorts")
+		return
+	}
+
+	matrix := CohortMatrix{
+		Metric: metric,
+	}
+	cohortIndex := make(map[int64]int)
+	heightIndex := make(map[int64]int)
+	for _, cohort := range cohorts {
+		if _, ok := cohortIndex[cohort.CohortHeight]; !ok {
+			cohortIndex[cohort.CohortHeight] = len(matrix.Cohorts)
+			matrix.Cohorts = append(matrix.Cohorts, cohort.CohortHeight)
+		}
+		if _, ok := heightIndex[cohort.Height]; !ok {
+			heightIndex[cohort.Height] = 0
+			matrix.Heights = append(matrix.Heights, cohort.Height)
+		}
+	}
+	sort.Slice(matrix.Heights, func(x, y int) bool {
+		return matrix.Heights[x] < matrix.Heights[y]
+	})
+	for position, height := range matrix.Heights {
+		heightIndex[height] = position
+	}
+
+	matrix.Values = make([][]*float64, len(matrix.Cohorts))
+	for position := range matrix.Values {
+		matrix.Values[position] = make([]*float64, len(matrix.Heights))
+	}
+	for _, cohort := range cohorts {
+		cell := value(cohort)
+		matrix.Values[cohortIndex[cohort.CohortHeight]][heightIndex[cohort.Height]] = &cell
+	}
+
+	a.writeJSON(w, http.StatusOK, matrix)
+}
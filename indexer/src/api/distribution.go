@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// handleDistributionHistory returns the distribution metrics of every
+// snapshot as a time series, optionally limited to a height range
+func (a *API) handleDistributionHistory(w http.ResponseWriter, r *http.Request) {
+	query := a.db.Order("height ASC")
+	for param, condition := range map[string]string{
+		"from_height": "height >= ?",
+		"to_height":   "height <= ?",
+	} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		height, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, param+" must be an integer")
+			return
+		}
+		query = query.Where(condition, height)
+	}
+
+	var distributions []models.DropletDistributionHistory
+	result := query.Find(&distributions)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch distribution history")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch distribution history")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, distributions)
+}
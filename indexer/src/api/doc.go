@@ -0,0 +1,3 @@
+// Package api provides the HTTP API serving the data computed by the
+// indexer
+package api
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer"
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// EntityResponse is an entity with its addresses and combined history
+type EntityResponse struct {
+	models.Entity
+	Addresses []string               `json:"addresses"`
+	History   []models.EntityHistory `json:"history,omitempty"`
+}
+
+// EntityLeaderboardEntry is an entity's position in the latest snapshot
+type EntityLeaderboardEntry struct {
+	models.EntityHistory
+	Name string `json:"name"`
+}
+
+// handleEntities lists the entities or creates one. Creating an entity with
+// an existing name replaces its addresses
+func (a *API) handleEntities(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var entities []models.Entity
+		result := a.db.Order("name ASC").Find(&entities)
+		if result.Error != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": result.Error,
+			}).Error("Unable to fetch entities")
+			a.writeError(w, http.StatusInternalServerError, "unable to fetch entities")
+			return
+		}
+
+		response := make([]EntityResponse, 0, len(entities))
+		for _, entity := range entities {
+			addresses, err := a.entityAddresses(entity.ID)
+			if err != nil {
+				a.logger.WithFields(logrus.Fields{
+					"err": err,
+				}).Error("Unable to fetch entity addresses")
+				a.writeError(w, http.StatusInternalServerError, "unable to fetch entity addresses")
+				return
+			}
+			response = append(response, EntityResponse{
+				Entity:    entity,
+				Addresses: addresses,
+			})
+		}
+		a.writeJSON(w, http.StatusOK, response)
+
+	case http.MethodPost:
+		var definition indexer.EntityDefinition
+		err := json.NewDecoder(r.Body).Decode(&definition)
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, "invalid entity")
+			return
+		}
+		a.saveEntity(w, definition)
+
+	default:
+		a.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleEntity returns, replaces the addresses of, or deletes an entity
+func (a *API) handleEntity(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, "id must be an integer")
+		return
+	}
+
+	var entity models.Entity
+	result := a.db.First(&entity, id)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			a.writeError(w, http.StatusNotFound, "entity not found")
+			return
+		}
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch entity")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch entity")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		addresses, err := a.entityAddresses(entity.ID)
+		if err != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("Unable to fetch entity addresses")
+			a.writeError(w, http.StatusInternalServerError, "unable to fetch entity addresses")
+			return
+		}
+		var history []models.EntityHistory
+		result = a.db.Where("entity_id = ?", entity.ID).Order("height ASC").Find(&history)
+		if result.Error != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": result.Error,
+			}).Error("Unable to fetch entity history")
+			a.writeError(w, http.StatusInternalServerError, "unable to fetch entity history")
+			return
+		}
+		a.writeJSON(w, http.StatusOK, EntityResponse{
+			Entity:    entity,
+			Addresses: addresses,
+			History:   history,
+		})
+
+	case http.MethodPut:
+		var definition indexer.EntityDefinition
+		err := json.NewDecoder(r.Body).Decode(&definition)
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, "invalid entity")
+			return
+		}
+		definition.Name = entity.Name
+		a.saveEntity(w, definition)
+
+	case http.MethodDelete:
+		err := indexer.DeleteEntity(a.db, entity)
+		if err != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("Unable to delete entity")
+			a.writeError(w, http.StatusInternalServerError, "unable to delete entity")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		a.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleEntityLeaderboard returns the entities ordered by their position in
+// the latest snapshot
+func (a *API) handleEntityLeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var entries []EntityLeaderboardEntry
+	result := a.db.Model(&models.EntityHistory{}).
+		Select("entity_history.*, entity.name").
+		Joins("JOIN entity ON entity.id = entity_history.entity_id").
+		Where("entity_history.height = (?)", a.db.Model(&models.EntityHistory{}).Select("MAX(height)")).
+		Order("entity_history.position ASC").
+		Limit(limit).
+		Offset(offset).
+		Scan(&entries)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch entity leaderboard")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch entity leaderboard")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, entries)
+}
+
+// saveEntity validates and stores a user declared entity
+func (a *API) saveEntity(w http.ResponseWriter, definition indexer.EntityDefinition) {
+	err := indexer.ValidateEntityDefinition(&definition)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	entity, err := indexer.SaveEntity(a.db, definition, models.EntitySourceUser)
+	if err != nil {
+		if strings.Contains(err.Error(), "duplicate key value") {
+			a.writeError(w, http.StatusConflict, "an address already belongs to another entity")
+			return
+		}
+		a.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to store entity")
+		a.writeError(w, http.StatusInternalServerError, "unable to store entity")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, EntityResponse{
+		Entity:    entity,
+		Addresses: definition.Addresses,
+	})
+}
+
+// entityAddresses returns the addresses of an entity
+func (a *API) entityAddresses(entityID uint64) ([]string, error) {
+	var addresses []string
+	result := a.db.Model(&models.EntityAddress{}).
+		Where("entity_id = ?", entityID).
+		Order("address ASC").
+		Pluck("address", &addresses)
+	return addresses, result.Error
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer"
+	"github.com/sirupsen/logrus"
+)
+
+// Trailers of an export response, sent after the rows have been streamed
+const (
+	trailerExportRows   = "X-Export-Rows"
+	trailerExportSHA256 = "X-Export-Sha256"
+)
+
+// exportFilterParams parses the filter of an export from the query, writing
+// the error response if it can't
+func (a *API) exportFilterParams(w http.ResponseWriter, r *http.Request) (indexer.ExportFilter, bool) {
+	var filter indexer.ExportFilter
+	for param, target := range map[string]*int64{
+		"height":      &filter.FromHeight,
+		"from_height": &filter.FromHeight,
+		"to_height":   &filter.ToHeight,
+	} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		height, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || height <= 0 {
+			a.writeError(w, http.StatusBadRequest, param+" must be a positive integer")
+			return filter, false
+		}
+		*target = height
+	}
+	if r.URL.Query().Has("height") {
+		if r.URL.Query().Has("from_height") || r.URL.Query().Has("to_height") {
+			a.writeError(w, http.StatusBadRequest, "height can't be combined with from_height or to_height")
+			return filter, false
+		}
+		filter.ToHeight = filter.FromHeight
+	}
+
+	for param, end := range map[string]bool{"from_date": false, "to_date": true} {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		date, err := indexer.ParseExportDate(value, end)
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, param+" must be a date as YYYY-MM-DD or RFC3339")
+			return filter, false
+		}
+		if end {
+			filter.Until = date
+		} else {
+			filter.Since = date
+		}
+	}
+
+	if r.URL.Query().Has("address") {
+		resolved, ok := a.addressParam(w, r)
+		if !ok {
+			return filter, false
+		}
+		filter.Address = resolved.Address
+	}
+	return filter, true
+}
+
+// exportFormatParam returns the format query parameter, NDJSON by default
+func exportFormatParam(r *http.Request) string {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return indexer.FormatNDJSON
+	}
+	return format
+}
+
+// handleExport streams a dataset as NDJSON, CSV or Parquet, optionally
+// filtered by height or date range. The row count and checksum of the body
+// are sent as trailers once it has been written. Several datasets, or all of
+// them, are streamed as a zip with a manifest
+func (a *API) handleExport(w http.ResponseWriter, r *http.Request) {
+	dataset := r.URL.Query().Get("dataset")
+	format := exportFormatParam(r)
+	filter, ok := a.exportFilterParams(w, r)
+	if !ok {
+		return
+	}
+
+	if dataset == "all" || strings.Contains(dataset, ",") {
+		var datasets []string
+		if dataset == "all" {
+			// Leave out the datasets the filter doesn't apply to
+			for _, name := range indexer.ExportDatasets {
+				if indexer.ValidateExport(name, format, filter) == nil {
+					datasets = append(datasets, name)
+				}
+			}
+		} else {
+			datasets = strings.Split(dataset, ",")
+		}
+		for _, name := range datasets {
+			err := indexer.ValidateExport(name, format, filter)
+			if err != nil {
+				a.writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+		}
+		if len(datasets) == 0 {
+			a.writeError(w, http.StatusBadRequest, "the filter applies to none of the datasets")
+			return
+		}
+		a.handleExportArchive(w, r, datasets, format, filter)
+		return
+	}
+
+	err := indexer.ValidateExport(dataset, format, filter)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	name := dataset + indexer.ExportExtension(format)
+	w.Header().Set("Content-Type", indexer.ExportContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Trailer", trailerExportRows+", "+trailerExportSHA256)
+	w.WriteHeader(http.StatusOK)
+
+	file, err := indexer.WriteExport(r.Context(), a.db, w, dataset, format, filter)
+	if err != nil {
+		// The status has been sent, the missing trailers tell the client the
+		// export is incomplete
+		a.logger.WithFields(logrus.Fields{
+			"dataset": dataset,
+			"format":  format,
+			"rows":    file.Rows,
+			"err":     err,
+		}).Error("Unable to export dataset")
+		return
+	}
+	w.Header().Set(trailerExportRows, strconv.FormatInt(file.Rows, 10))
+	w.Header().Set(trailerExportSHA256, file.SHA256)
+}
+
+// handleExportArchive streams every dataset the filter applies to, or the
+// ones listed in dataset, as a zip along with a manifest.json of their row
+// counts and checksums, all read from the same snapshot of the database
+func (a *API) handleExportArchive(w http.ResponseWriter, r *http.Request, datasets []string, format string, filter indexer.ExportFilter) {
+	archive := zip.NewWriter(w)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.zip"`)
+	w.WriteHeader(http.StatusOK)
+
+	manifest, err := indexer.ExportFiles(r.Context(), a.db, datasets, format, filter,
+		func(name string) (io.WriteCloser, error) {
+			file, err := archive.CreateHeader(&zip.FileHeader{
+				Name:     name,
+				Method:   zip.Deflate,
+				Modified: time.Now().UTC(),
+			})
+			return nopCloser{file}, err
+		})
+	if err == nil {
+		var file io.Writer
+		file, err = archive.Create("manifest.json")
+		if err == nil {
+			encoder := json.NewEncoder(file)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(manifest)
+		}
+	}
+	if err != nil {
+		// The status has been sent, the zip is left without its central
+		// directory so the client sees it is incomplete
+		a.logger.WithFields(logrus.Fields{
+			"datasets": datasets,
+			"format":   format,
+			"err":      err,
+		}).Error("Unable to export datasets")
+		return
+	}
+	err = archive.Close()
+	if err != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Warning("Unable to write response")
+	}
+}
+
+// nopCloser leaves the zip open when an exported file is done
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
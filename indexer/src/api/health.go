@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// checkTimeout bounds the time a health or readiness check may take
+const checkTimeout = time.Second * 5
+
+// Check reports an error if a component isn't healthy or ready
+type Check func(ctx context.Context) error
+
+// checkResponse is the body returned by the health and readiness endpoints
+type checkResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// CheckHandler serves the result of the checks, responding with 503 on the
+// first one that fails
+func CheckHandler(checks ...Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+		defer cancel()
+
+		status := http.StatusOK
+		response := checkResponse{Status: "ok"}
+		for _, check := range checks {
+			err := check(ctx)
+			if err != nil {
+				status = http.StatusServiceUnavailable
+				response = checkResponse{Status: "unavailable", Error: err.Error()}
+				break
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// SetChecks adds the health and readiness checks of the indexer to the ones
+// of the API
+func (a *API) SetChecks(healthy Check, ready Check) {
+	a.healthy = healthy
+	a.ready = ready
+}
+
+// handleHealthz reports whether the indexer is stuck
+func (a *API) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	var checks []Check
+	if a.healthy != nil {
+		checks = append(checks, a.healthy)
+	}
+	CheckHandler(checks...)(w, r)
+}
+
+// handleReadyz reports whether the database, and the RPC used by the
+// indexer, can be reached
+func (a *API) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	checks := []Check{a.pingDB}
+	if a.ready != nil {
+		checks = append(checks, a.ready)
+	}
+	CheckHandler(checks...)(w, r)
+}
+
+// pingDB checks the API's database connection
+func (a *API) pingDB(ctx context.Context) error {
+	db, err := a.db.DB()
+	if err != nil {
+		return err
+	}
+	return db.PingContext(ctx)
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Label is the label attached to an address in responses
+type Label struct {
+	Name     string `json:"name"`
+	Category string `json:"category"`
+	Source   string `json:"source"`
+}
+
+// LabelledEntry is an address with its Droplets and optional label
+type LabelledEntry struct {
+	Address  string `json:"address"`
+	Droplets uint64 `json:"droplets"`
+	Label    *Label `json:"label,omitempty"`
+}
+
+// LeaderboardEntry is a leaderboard row with its label
+type LeaderboardEntry struct {
+	LabelledEntry
+	Position int64 `json:"position"`
+}
+
+// HistoryEntry is a history row with its label
+type HistoryEntry struct {
+	LabelledEntry
+	Height    int64     `json:"height"`
+	DateBlock time.Time `json:"date_block"`
+}
+
+// MoverEntry is the change in Droplets of an address between two snapshots
+type MoverEntry struct {
+	LabelledEntry
+	Change int64 `json:"change"`
+}
+
+// labelsFor returns the labels of the addresses, keyed by address
+func (a *API) labelsFor(addresses []string) (map[string]*Label, error) {
+	labels := make(map[string]*Label)
+	if len(addresses) == 0 {
+		return labels, nil
+	}
+
+	var rows []models.AddressLabel
+	result := a.db.Where("address IN ?", addresses).Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, row := range rows {
+		labels[row.Address] = &Label{
+			Name:     row.Name,
+			Category: row.Category,
+			Source:   row.Source,
+		}
+	}
+	return labels, nil
+}
+
+// handleLabels lists the address labels, optionally only for an address or
+// category
+func (a *API) handleLabels(w http.ResponseWriter, r *http.Request) {
+	query := a.db.Order("address ASC")
+	if r.URL.Query().Get("address") != "" {
+		resolved, ok := a.addressParam(w, r)
+		if !ok {
+			return
+		}
+		query = query.Where("address = ?", resolved.Address)
+	}
+	if category := r.URL.Query().Get("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+
+	var labels []models.AddressLabel
+	result := query.Find(&labels)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch labels")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch labels")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, labels)
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer"
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// handleLeaderboard returns a page of the leaderboard with address labels
+func (a *API) handleLeaderboard(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var rows []models.DropletLeaderboard
+	result := a.db.Order("position ASC").Limit(limit).Offset(offset).Find(&rows)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch leaderboard")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch leaderboard")
+		return
+	}
+
+	addresses := make([]string, 0, len(rows))
+	for _, row := range rows {
+		addresses = append(addresses, row.Address)
+	}
+	labels, err := a.labelsFor(addresses)
+	if err != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to fetch labels")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch labels")
+		return
+	}
+
+	entries := make([]LeaderboardEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, LeaderboardEntry{
+			LabelledEntry: LabelledEntry{
+				Address:  row.Address,
+				Droplets: row.Droplets,
+				Label:    labels[row.Address],
+			},
+			Position: row.Position,
+		})
+	}
+
+	a.writeJSON(w, http.StatusOK, entries)
+}
+
+// AddressHistoryResponse is the Droplet history of an address along with
+// the Neutron address the lookup resolved to
+type AddressHistoryResponse struct {
+	Resolved indexer.ResolvedAddress `json:"resolved"`
+	History  []HistoryEntry          `json:"history"`
+}
+
+// handleAddressHistory returns the Droplet history of an address with its
+// label. Addresses from other coin type 118 chains are resolved to Neutron
+func (a *API) handleAddressHistory(w http.ResponseWriter, r *http.Request) {
+	resolved, ok := a.addressParam(w, r)
+	if !ok {
+		return
+	}
+	address := resolved.Address
+
+	var rows []models.DropletAddressHistory
+	result := a.db.Where("address = ?", address).Order("height ASC").Find(&rows)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch address history")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch address history")
+		return
+	}
+
+	labels, err := a.labelsFor([]string{address})
+	if err != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to fetch labels")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch labels")
+		return
+	}
+
+	entries := make([]HistoryEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, HistoryEntry{
+			LabelledEntry: LabelledEntry{
+				Address:  row.Address,
+				Droplets: row.Droplets,
+				Label:    labels[row.Address],
+			},
+			Height:    row.Height,
+			DateBlock: row.DateBlock,
+		})
+	}
+
+	a.writeJSON(w, http.StatusOK, AddressHistoryResponse{
+		Resolved: resolved,
+		History:  entries,
+	})
+}
+
+// handleMovers returns the addresses that gained the most Droplets between
+// the two latest snapshots, with their labels
+func (a *API) handleMovers(w http.ResponseWriter, r *http.Request) {
+	limit, _, err := pageParams(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var heights []int64
+	result := a.db.Model(&models.DropletStatsHistory{}).
+		Order("height DESC").
+		Limit(2).
+		Pluck("height", &heights)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch snapshot heights")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch snapshot heights")
+		return
+	}
+	if len(heights) < 2 {
+		a.writeJSON(w, http.StatusOK, []MoverEntry{})
+		return
+	}
+
+	var rows []struct {
+		Address  string
+		Droplets uint64
+		Change   int64
+	}
+	result = a.db.Raw(`
+		SELECT
+			latest.address,
+			latest.droplets,
+			latest.droplets - COALESCE(earlier.droplets, 0) AS change
+		FROM droplet_address_history latest
+		LEFT JOIN droplet_address_history earlier
+			ON earlier.address = latest.address AND earlier.height = ?
+		WHERE latest.height = ? AND latest.excluded = false
+		ORDER BY change DESC
+		LIMIT ?`, heights[1], heights[0], limit).Scan(&rows)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch movers")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch movers")
+		return
+	}
+
+	addresses := make([]string, 0, len(rows))
+	for _, row := range rows {
+		addresses = append(addresses, row.Address)
+	}
+	labels, err := a.labelsFor(addresses)
+	if err != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to fetch labels")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch labels")
+		return
+	}
+
+	entries := make([]MoverEntry, 0, len(rows))
+	for _, row := range rows {
+		entries = append(entries, MoverEntry{
+			LabelledEntry: LabelledEntry{
+				Address:  row.Address,
+				Droplets: row.Droplets,
+				Label:    labels[row.Address],
+			},
+			Change: row.Change,
+		})
+	}
+
+	a.writeJSON(w, http.StatusOK, entries)
+}
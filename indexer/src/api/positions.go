@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer"
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// PositionsResponse is a list of dATOM position estimates along with the
+// assumptions of the model that produced them
+type PositionsResponse struct {
+	Resolved    *indexer.ResolvedAddress        `json:"resolved,omitempty"`
+	Assumptions []string                        `json:"assumptions"`
+	Positions   []models.DropletAddressPosition `json:"positions"`
+}
+
+// handleAddressPositions returns the estimated dATOM position of an address
+// for every snapshot
+func (a *API) handleAddressPositions(w http.ResponseWriter, r *http.Request) {
+	resolved, ok := a.addressParam(w, r)
+	if !ok {
+		return
+	}
+	address := resolved.Address
+
+	var positions []models.DropletAddressPosition
+	result := a.db.Where("address = ?", address).Order("height").Find(&positions)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch positions")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch positions")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, PositionsResponse{
+		Resolved:    &resolved,
+		Assumptions: indexer.PositionAssumptions,
+		Positions:   positions,
+	})
+}
+
+// handleFlaggedPositions returns the addresses whose accrual rate changed
+// sharply at a height, the latest if none is given
+func (a *API) handleFlaggedPositions(w http.ResponseWriter, r *http.Request) {
+	height, err := a.heightParam(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, "height must be an integer")
+		return
+	}
+
+	var positions []models.DropletAddressPosition
+	query := a.db.Where("flagged = ?", true)
+	if height > 0 {
+		query = query.Where("height = ?", height)
+	} else {
+		query = query.Where("height = (?)", a.db.Model(&models.DropletAddressPosition{}).Select("MAX(height)"))
+	}
+	result := query.Order("rate_change DESC").Find(&positions)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch flagged positions")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch flagged positions")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, PositionsResponse{
+		Assumptions: indexer.PositionAssumptions,
+		Positions:   positions,
+	})
+}
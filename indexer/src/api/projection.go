@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer"
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// ProjectionResponse is the projected balance and rank of an address at a
+// future date for every fitted window
+type ProjectionResponse struct {
+	Resolved  indexer.ResolvedAddress `json:"resolved"`
+	Address   string                  `json:"address"`
+	Date      time.Time               `json:"date"`
+	Height    int64                   `json:"height"`
+	DateBlock time.Time               `json:"date_block"`
+	Droplets  uint64                  `json:"droplets"`
+	Windows   []WindowProjection      `json:"windows"`
+}
+
+// WindowProjection is the projection based on the rate fitted over a single
+// window. Bounds are the 95% confidence interval of the fitted rate, null
+// with LowConfidence set when there are too few samples to estimate it
+type WindowProjection struct {
+	WindowDays    int      `json:"window_days"`
+	Samples       int      `json:"samples"`
+	LowConfidence bool     `json:"low_confidence"`
+	Rate          float64  `json:"rate_per_day"`
+	RateLower     *float64 `json:"rate_per_day_lower"`
+	RateUpper     *float64 `json:"rate_per_day_upper"`
+	Droplets      float64  `json:"projected_droplets"`
+	DropletsLower *float64 `json:"projected_droplets_lower"`
+	DropletsUpper *float64 `json:"projected_droplets_upper"`
+	Rank          int64    `json:"projected_rank"`
+	RankBest      *int64   `json:"projected_rank_best"`
+	RankWorst     *int64   `json:"projected_rank_worst"`
+}
+
+// handleAddressProjection projects the balance and rank of an address at
+// the given date, assuming the fitted earning rates hold
+func (a *API) handleAddressProjection(w http.ResponseWriter, r *http.Request) {
+	resolved, ok := a.addressParam(w, r)
+	if !ok {
+		return
+	}
+	address := resolved.Address
+	date, err := parseDate(r.URL.Query().Get("date"))
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, "date must be YYYY-MM-DD or RFC3339")
+		return
+	}
+
+	var rates []models.DropletAddressRate
+	result := a.db.Where("address = ?", address).Order("window_days").Find(&rates)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch earning rates")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch earning rates")
+		return
+	}
+	if len(rates) == 0 {
+		a.writeError(w, http.StatusNotFound, "no earning rate for address")
+		return
+	}
+
+	response := ProjectionResponse{
+		Resolved:  resolved,
+		Address:   address,
+		Date:      date,
+		Height:    rates[0].Height,
+		DateBlock: rates[0].DateBlock,
+		Droplets:  rates[0].Droplets,
+	}
+
+	for _, rate := range rates {
+		days := date.Sub(rate.DateBlock).Hours() / 24
+		if days < 0 {
+			a.writeError(w, http.StatusBadRequest, "date is before the latest snapshot")
+			return
+		}
+
+		projection := WindowProjection{
+			WindowDays:    rate.WindowDays,
+			Samples:       rate.Samples,
+			LowConfidence: rate.RateLower == nil || rate.RateUpper == nil,
+			Rate:          rate.Rate,
+			RateLower:     rate.RateLower,
+			RateUpper:     rate.RateUpper,
+			Droplets:      float64(rate.Droplets) + rate.Rate*days,
+		}
+
+		projected, err := a.projectedBalances(rate.WindowDays, address, days)
+		if err != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("Unable to project balances")
+			a.writeError(w, http.StatusInternalServerError, "unable to project balances")
+			return
+		}
+		projection.Rank = projectedRank(projected, projection.Droplets)
+		if !projection.LowConfidence {
+			lower := float64(rate.Droplets) + *rate.RateLower*days
+			upper := float64(rate.Droplets) + *rate.RateUpper*days
+			best := projectedRank(projected, upper)
+			worst := projectedRank(projected, lower)
+			projection.DropletsLower = &lower
+			projection.DropletsUpper = &upper
+			projection.RankBest = &best
+			projection.RankWorst = &worst
+		}
+
+		response.Windows = append(response.Windows, projection)
+	}
+
+	a.writeJSON(w, http.StatusOK, response)
+}
+
+// projectedBalances projects every other address forward by days using the
+// rates fitted for windowDays
+func (a *API) projectedBalances(windowDays int, exclude string, days float64) ([]float64, error) {
+	var rates []models.DropletAddressRate
+	result := a.db.Select("address, droplets, rate").
+		Where("window_days = ? AND address <> ?", windowDays, exclude).
+		Find(&rates)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	projected := make([]float64, len(rates))
+	for index, rate := range rates {
+		projected[index] = float64(rate.Droplets) + rate.Rate*days
+	}
+	return projected, nil
+}
+
+// projectedRank returns the 1-based rank droplets would have among the
+// projected balances
+func projectedRank(projected []float64, droplets float64) int64 {
+	rank := int64(1)
+	for _, other := range projected {
+		if other > droplets {
+			rank++
+		}
+	}
+	return rank
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// handleQuarantinedKeys lists the contract state keys that failed validation,
+// optionally only for a height
+func (a *API) handleQuarantinedKeys(w http.ResponseWriter, r *http.Request) {
+	height, err := a.heightParam(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, "height must be an integer")
+		return
+	}
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var keys []models.DropletKeyQuarantine
+	query := a.db.Order("height DESC, raw_key ASC").Limit(limit).Offset(offset)
+	if height > 0 {
+		query = query.Where("height = ?", height)
+	}
+	result := query.Find(&keys)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch quarantined keys")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch quarantined keys")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, keys)
+}
+
+// handleQuarantinedSnapshots lists the snapshots held back by the anomaly
+// guards, approves one so it is captured on the next pass, or removes one
+// so it is checked again
+func (a *API) handleQuarantinedSnapshots(w http.ResponseWriter, r *http.Request) {
+	height, err := a.heightParam(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, "height must be an integer")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var snapshots []models.SnapshotQuarantine
+		query := a.db.Order("height DESC")
+		if height > 0 {
+			query = query.Where("height = ?", height)
+		}
+		result := query.Find(&snapshots)
+		if result.Error != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": result.Error,
+			}).Error("Unable to fetch quarantined snapshots")
+			a.writeError(w, http.StatusInternalServerError, "unable to fetch quarantined snapshots")
+			return
+		}
+		a.writeJSON(w, http.StatusOK, snapshots)
+
+	case http.MethodPost:
+		if height == 0 {
+			a.writeError(w, http.StatusBadRequest, "height is required")
+			return
+		}
+		result := a.db.Model(&models.SnapshotQuarantine{}).
+			Where("height = ?", height).
+			Updates(map[string]any{
+				"approved":      true,
+				"date_approved": time.Now(),
+			})
+		if result.Error != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": result.Error,
+			}).Error("Unable to approve snapshot")
+			a.writeError(w, http.StatusInternalServerError, "unable to approve snapshot")
+			return
+		}
+		if result.RowsAffected == 0 {
+			a.writeError(w, http.StatusNotFound, "snapshot not quarantined")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case http.MethodDelete:
+		if height == 0 {
+			a.writeError(w, http.StatusBadRequest, "height is required")
+			return
+		}
+		result := a.db.Where("height = ?", height).Delete(&models.SnapshotQuarantine{})
+		if result.Error != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": result.Error,
+			}).Error("Unable to remove quarantined snapshot")
+			a.writeError(w, http.StatusInternalServerError, "unable to remove quarantined snapshot")
+			return
+		}
+		if result.RowsAffected == 0 {
+			a.writeError(w, http.StatusNotFound, "snapshot not quarantined")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		a.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
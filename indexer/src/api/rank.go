@@ -0,0 +1,230 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// maxRankIndexes is the number of snapshot rank indexes kept in memory
+const maxRankIndexes = 8
+
+// rankIndex is the sorted list of balances of a single snapshot, used to
+// answer rank lookups with a binary search
+type rankIndex struct {
+	height int64
+	// stored is when the snapshot's stats were stored, a reprocessed
+	// snapshot has a later one
+	stored time.Time
+	// balances in descending order
+	balances []uint64
+}
+
+// thresholdForRank returns the Droplets needed to reach rank
+func (index *rankIndex) thresholdForRank(rank int64) (uint64, bool) {
+	if rank < 1 || rank > int64(len(index.balances)) {
+		return 0, false
+	}
+	return index.balances[rank-1], true
+}
+
+// rankFor returns the rank an address with droplets would have, one more
+// than the number of addresses holding more
+func (index *rankIndex) rankFor(droplets uint64) int64 {
+	above := sort.Search(len(index.balances), func(position int) bool {
+		return index.balances[position] <= droplets
+	})
+	return int64(above) + 1
+}
+
+// rankIndexCache holds the most recently used rank indexes
+type rankIndexCache struct {
+	mutex   sync.Mutex
+	indexes []*rankIndex
+}
+
+// get returns the cached index for height built from the snapshot stored
+// at stored, moving it to the front
+func (cache *rankIndexCache) get(height int64, stored time.Time) *rankIndex {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	for position, index := range cache.indexes {
+		if index.height == height && index.stored.Equal(stored) {
+			copy(cache.indexes[1:position+1], cache.indexes[:position])
+			cache.indexes[0] = index
+			return index
+		}
+	}
+	return nil
+}
+
+// add stores index at the front, replacing an outdated index of its height
+// and evicting the least recently used one
+func (cache *rankIndexCache) add(index *rankIndex) {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	indexes := []*rankIndex{index}
+	for _, cached := range cache.indexes {
+		if cached.height != index.height {
+			indexes = append(indexes, cached)
+		}
+	}
+	cache.indexes = indexes
+	if len(cache.indexes) > maxRankIndexes {
+		cache.indexes = cache.indexes[:maxRankIndexes]
+	}
+}
+
+// RankThresholdResponse is the number of Droplets needed to reach a rank
+type RankThresholdResponse struct {
+	Height     int64   `json:"height"`
+	Rank       int64   `json:"rank"`
+	Droplets   uint64  `json:"droplets"`
+	Addresses  int64   `json:"addresses"`
+	Percentile float64 `json:"percentile"`
+}
+
+// rankIndexFor returns the rank index of the snapshot at height, building it
+// from the snapshot's history if it isn't cached or the snapshot has been
+// reprocessed since. A zero height selects the latest snapshot
+func (a *API) rankIndexFor(height int64) (*rankIndex, error) {
+	var snapshot models.DropletStatsHistory
+	query := a.db.Select("height, date_created").Order("height DESC")
+	if height > 0 {
+		query = query.Where("height = ?", height)
+	}
+	result := query.Limit(1).Find(&snapshot)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if height == 0 {
+		height = snapshot.Height
+	}
+
+	index := a.rankIndexes.get(height, snapshot.DateCreated)
+	if index != nil {
+		return index, nil
+	}
+
+	index = &rankIndex{height: height, stored: snapshot.DateCreated}
+	result = a.db.Model(&models.DropletAddressHistory{}).
+		Where("height = ? AND excluded = ?", height, false).
+		Order("droplets DESC").
+		Pluck("droplets", &index.balances)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(index.balances) > 0 {
+		a.rankIndexes.add(index)
+	}
+	return index, nil
+}
+
+// handleRankThreshold returns the Droplets needed to reach a rank
+func (a *API) handleRankThreshold(w http.ResponseWriter, r *http.Request) {
+	rank, err := strconv.ParseInt(r.URL.Query().Get("rank"), 10, 64)
+	if err != nil || rank < 1 {
+		a.writeError(w, http.StatusBadRequest, "rank must be a positive integer")
+		return
+	}
+	index, ok := a.rankIndexParam(w, r)
+	if !ok {
+		return
+	}
+
+	droplets, ok := index.thresholdForRank(rank)
+	if !ok {
+		a.writeError(w, http.StatusNotFound, "rank is beyond the number of addresses")
+		return
+	}
+
+	addresses := int64(len(index.balances))
+	a.writeJSON(w, http.StatusOK, RankThresholdResponse{
+		Height:     index.height,
+		Rank:       rank,
+		Droplets:   droplets,
+		Addresses:  addresses,
+		Percentile: float64(rank) / float64(addresses) * 100,
+	})
+}
+
+// handleRankFor returns the rank an address holding the given Droplets
+// would have
+func (a *API) handleRankFor(w http.ResponseWriter, r *http.Request) {
+	droplets, err := strconv.ParseUint(r.URL.Query().Get("droplets"), 10, 64)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, "droplets must be a positive integer")
+		return
+	}
+	index, ok := a.rankIndexParam(w, r)
+	if !ok {
+		return
+	}
+
+	rank := index.rankFor(droplets)
+	addresses := int64(len(index.balances))
+	a.writeJSON(w, http.StatusOK, RankThresholdResponse{
+		Height:     index.height,
+		Rank:       rank,
+		Droplets:   droplets,
+		Addresses:  addresses,
+		Percentile: float64(rank) / float64(addresses) * 100,
+	})
+}
+
+// handleRankTiers returns the precomputed rank tiers of a snapshot, the
+// latest if no height is given
+func (a *API) handleRankTiers(w http.ResponseWriter, r *http.Request) {
+	height, err := a.heightParam(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, "height must be an integer")
+		return
+	}
+
+	var tiers []models.DropletRankTier
+	query := a.db.Order("rank ASC")
+	if height > 0 {
+		query = query.Where("height = ?", height)
+	} else {
+		query = query.Where("height = (?)", a.db.Model(&models.DropletRankTier{}).Select("MAX(height)"))
+	}
+	result := query.Find(&tiers)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch rank tiers")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch rank tiers")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, tiers)
+}
+
+// rankIndexParam loads the rank index for the height query parameter,
+// writing the error response if it can't
+func (a *API) rankIndexParam(w http.ResponseWriter, r *http.Request) (*rankIndex, bool) {
+	height, err := a.heightParam(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, "height must be an integer")
+		return nil, false
+	}
+	index, err := a.rankIndexFor(height)
+	if err != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err":    err,
+			"height": height,
+		}).Error("Unable to build rank index")
+		a.writeError(w, http.StatusInternalServerError, "unable to build rank index")
+		return nil, false
+	}
+	if len(index.balances) == 0 {
+		a.writeError(w, http.StatusNotFound, "no snapshot at height")
+		return nil, false
+	}
+	return index, true
+}
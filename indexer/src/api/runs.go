@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// LatestRunsResponse is the last finished pass of the indexer and the last
+// one that captured a snapshot
+type LatestRunsResponse struct {
+	LastChecked  *models.IndexerRun `json:"last_checked"`
+	LastCaptured *models.IndexerRun `json:"last_captured"`
+}
+
+// handleRuns lists the indexer passes, latest first, optionally only those
+// with an outcome
+func (a *API) handleRuns(w http.ResponseWriter, r *http.Request) {
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var runs []models.IndexerRun
+	query := a.db.Order("date_started DESC").Limit(limit).Offset(offset)
+	if outcome := r.URL.Query().Get("outcome"); outcome != "" {
+		query = query.Where("outcome = ?", outcome)
+	}
+	result := query.Find(&runs)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch runs")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch runs")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, runs)
+}
+
+// handleLatestRuns returns when the indexer last checked for an update and
+// when it last captured one
+func (a *API) handleLatestRuns(w http.ResponseWriter, r *http.Request) {
+	var response LatestRunsResponse
+	for _, latest := range []struct {
+		run   **models.IndexerRun
+		query *gorm.DB
+	}{
+		{&response.LastChecked, a.db.Where("outcome <> ?", models.IndexerRunRunning)},
+		{&response.LastCaptured, a.db.Where("outcome = ?", models.IndexerRunCaptured)},
+	} {
+		var run models.IndexerRun
+		result := latest.query.Order("date_started DESC").First(&run)
+		if result.Error != nil {
+			if result.Error == gorm.ErrRecordNotFound {
+				continue
+			}
+			a.logger.WithFields(logrus.Fields{
+				"err": result.Error,
+			}).Error("Unable to fetch latest runs")
+			a.writeError(w, http.StatusInternalServerError, "unable to fetch latest runs")
+			return
+		}
+		*latest.run = &run
+	}
+
+	a.writeJSON(w, http.StatusOK, response)
+}
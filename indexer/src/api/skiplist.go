@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer"
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// handleSkiplist lists, adds or removes skiplist entries. Changes apply from
+// the next snapshot captured. Removed entries are kept for the exclusions
+// that refer to them, and listed with removed=true
+func (a *API) handleSkiplist(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var entries []models.SkiplistEntry
+		query := a.db.Order("id ASC")
+		if r.URL.Query().Get("removed") == "true" {
+			query = query.Unscoped().Where("deleted_at IS NOT NULL")
+		}
+		result := query.Find(&entries)
+		if result.Error != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": result.Error,
+			}).Error("Unable to fetch skiplist")
+			a.writeError(w, http.StatusInternalServerError, "unable to fetch skiplist")
+			return
+		}
+		a.writeJSON(w, http.StatusOK, entries)
+
+	case http.MethodPost:
+		var entry models.SkiplistEntry
+		err := json.NewDecoder(r.Body).Decode(&entry)
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, "invalid skiplist entry")
+			return
+		}
+		entry.ID = 0
+		entry.DateCreated = time.Now()
+		err = indexer.ValidateSkiplistEntry(&entry)
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		result := a.db.Create(&entry)
+		if result.Error != nil && strings.Contains(result.Error.Error(), "duplicate key value") {
+			a.writeError(w, http.StatusConflict, "the address already has a skiplist entry")
+			return
+		}
+		if result.Error != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": result.Error,
+			}).Error("Unable to store skiplist entry")
+			a.writeError(w, http.StatusInternalServerError, "unable to store skiplist entry")
+			return
+		}
+		a.writeJSON(w, http.StatusCreated, entry)
+
+	case http.MethodDelete:
+		id, err := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+		if err != nil {
+			a.writeError(w, http.StatusBadRequest, "id must be an integer")
+			return
+		}
+		result := a.db.Delete(&models.SkiplistEntry{}, id)
+		if result.Error != nil {
+			a.logger.WithFields(logrus.Fields{
+				"err": result.Error,
+			}).Error("Unable to delete skiplist entry")
+			a.writeError(w, http.StatusInternalServerError, "unable to delete skiplist entry")
+			return
+		}
+		if result.RowsAffected == 0 {
+			a.writeError(w, http.StatusNotFound, "skiplist entry not found")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		a.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// handleExclusions lists the addresses excluded from a snapshot, the latest
+// if no height is given
+func (a *API) handleExclusions(w http.ResponseWriter, r *http.Request) {
+	height, err := a.heightParam(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, "height must be an integer")
+		return
+	}
+
+	var exclusions []models.DropletExclusionHistory
+	query := a.db.Order("droplets DESC")
+	if height > 0 {
+		query = query.Where("height = ?", height)
+	} else {
+		query = query.Where("height = (?)", a.db.Model(&models.DropletStatsHistory{}).Select("MAX(height)"))
+	}
+	result := query.Find(&exclusions)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch exclusions")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch exclusions")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, exclusions)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// StatsTotals are the totals of a snapshot
+type StatsTotals struct {
+	TotalDroplets  int64 `json:"total_droplets"`
+	TotalAddresses int64 `json:"total_addresses"`
+}
+
+// StatsResponse is a snapshot's totals, both excluding and including the
+// addresses on the skiplist
+type StatsResponse struct {
+	Height    int64       `json:"height"`
+	DateBlock time.Time   `json:"date_block"`
+	Excluding StatsTotals `json:"excluding"`
+	All       StatsTotals `json:"all"`
+}
+
+// handleStatsHistory returns the totals of every snapshot
+func (a *API) handleStatsHistory(w http.ResponseWriter, r *http.Request) {
+	var stats []models.DropletStatsHistory
+	result := a.db.Order("height ASC").Find(&stats)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch stats history")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch stats history")
+		return
+	}
+
+	response := make([]StatsResponse, 0, len(stats))
+	for _, item := range stats {
+		response = append(response, StatsResponse{
+			Height:    item.Height,
+			DateBlock: item.DateBlock,
+			Excluding: StatsTotals{
+				TotalDroplets:  item.TotalDroplets,
+				TotalAddresses: item.TotalAddresses,
+			},
+			All: StatsTotals{
+				TotalDroplets:  item.TotalDropletsAll,
+				TotalAddresses: item.TotalAddressesAll,
+			},
+		})
+	}
+
+	a.writeJSON(w, http.StatusOK, response)
+}
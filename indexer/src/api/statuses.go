@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// maxPageLimit is the largest number of rows returned by paginated endpoints
+const maxPageLimit = 1000
+
+// handleStatusHistory returns the number of new, active, declining, idle,
+// dormant and dropped addresses for every snapshot
+func (a *API) handleStatusHistory(w http.ResponseWriter, r *http.Request) {
+	var counts []models.DropletStatusHistory
+	result := a.db.Order("height ASC").Find(&counts)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch status history")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch status history")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, counts)
+}
+
+// handleStatusAddresses lists the addresses with a status at a height, the
+// latest if none is given
+func (a *API) handleStatusAddresses(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case models.AddressStatusNew, models.AddressStatusActive, models.AddressStatusDeclining,
+		models.AddressStatusIdle, models.AddressStatusDormant, models.AddressStatusDropped:
+	default:
+		a.writeError(w, http.StatusBadRequest, "status must be one of new, active, declining, idle, dormant or dropped")
+		return
+	}
+	height, err := a.heightParam(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, "height must be an integer")
+		return
+	}
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		a.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var statuses []models.DropletAddressStatus
+	query := a.db.Where("status = ?", status)
+	if height > 0 {
+		query = query.Where("height = ?", height)
+	} else {
+		query = query.Where("height = (?)", a.db.Model(&models.DropletStatusHistory{}).Select("MAX(height)"))
+	}
+	result := query.Order("droplets DESC").Limit(limit).Offset(offset).Find(&statuses)
+	if result.Error != nil {
+		a.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to fetch addresses by status")
+		a.writeError(w, http.StatusInternalServerError, "unable to fetch addresses by status")
+		return
+	}
+
+	a.writeJSON(w, http.StatusOK, statuses)
+}
+
+// pageParams returns the limit and offset query parameters
+func pageParams(r *http.Request) (int, int, error) {
+	limit := 100
+	offset := 0
+	var err error
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			return 0, 0, errInvalidLimit
+		}
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		offset, err = strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			return 0, 0, errInvalidOffset
+		}
+	}
+	return limit, offset, nil
+}
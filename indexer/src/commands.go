@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer"
+	log "github.com/sirupsen/logrus"
+)
+
+// command is a subcommand of the indexer that runs once and exits
+type command struct {
+	// args and description are shown by help
+	args        string
+	description string
+	// readOnly commands don't capture snapshots, they run on an indexer that
+	// doesn't migrate the schema or need the capture settings
+	readOnly bool
+	run      func(ctx context.Context, logger *log.Entry, service *indexer.Indexer, args []string) int
+}
+
+// commands are the subcommands besides run, which serves, and config, which
+// is handled before the service is constructed
+var commands = map[string]command{
+	"once": {
+		description: "Run a single pass and exit",
+		run:         runOnce,
+	},
+	"backfill": {
+		args:        "--from <height> --to <height> [--step <blocks>]",
+		description: "Capture a snapshot every step blocks over a height range",
+		run:         runBackfill,
+	},
+	"verify": {
+		args:        "[--height <height>]",
+		description: "Check a captured snapshot against the contract state and record the result, exits non-zero unless verified",
+		run:         runVerify,
+	},
+	"export": {
+		args:        "--dataset <names|all> [--format <ndjson|csv|parquet>] [--height <height> | --from-height <height> --to-height <height>] [--from-date <date>] [--to-date <date>] [--address <address>] [--out <file> | --dir <dir>]",
+		description: "Write datasets as NDJSON, CSV or Parquet, to a directory along with a manifest of row counts and checksums",
+		readOnly:    true,
+		run:         runExport,
+	},
+	"inspect-address": {
+		args:        "<address>",
+		description: "Print the stored history and the live on-chain balance of an address",
+		readOnly:    true,
+		run:         runInspectAddress,
+	},
+	"check-balance": {
+		args:        "<address> [--height <height>] [--lookup <smart|raw>]",
+		description: "Compare the on-chain balance of an address at a height with the stored one, exits non-zero on a discrepancy",
+		readOnly:    true,
+		run:         runCheckBalance,
+	},
+	"reprocess": {
+		args:        "[--height <height> | --from <height> --to <height>]",
+		description: "Re-derive the captured snapshots from the archived contract state without querying the chain",
+		run:         runReprocess,
+	},
+	"dump-state": {
+		args:        "[--height <height>] [--out <file>]",
+		description: "Write the decoded contract state at a height, the latest by default",
+		readOnly:    true,
+		run:         runDumpState,
+	},
+}
+
+// commandOrder is the order commands are listed in by help
+var commandOrder = []string{"once", "backfill", "verify", "export", "inspect-address", "check-balance", "reprocess", "dump-state"}
+
+// parseCommand splits the arguments into the command and its arguments.
+// Without a command the service runs a single pass, as it did before the
+// commands were added
+func parseCommand(args []string) (string, []string) {
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		return "help", nil
+	}
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return "", args
+	}
+	return args[0], args[1:]
+}
+
+// usage writes the list of commands to w
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: indexer [command] [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	fmt.Fprintln(w, "  run\n\tRun a pass every PASS_INTERVAL until stopped, serving the API and metrics")
+	for _, name := range commandOrder {
+		fmt.Fprintf(w, "  %s\n\t%s\n", strings.TrimSpace(name+" "+commands[name].args), commands[name].description)
+	}
+	fmt.Fprintln(w, "  config print\n\tPrint the effective config with secrets masked")
+	fmt.Fprintln(w, "  help\n\tShow this help")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Without a command a single pass runs and the API, if enabled, is served until stopped.")
+}
+
+// runExitCode returns the exit code for the error a run returned, logging
+// failures
+func runExitCode(logger *log.Entry, err error) int {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return exitStopped
+	}
+	logger.WithFields(log.Fields{
+		"kind": indexer.KindOf(err),
+	}).Errorf("Unable to run service: %v", err)
+	return exitFailure
+}
+
+// nopCloser keeps stdout open when a command is done writing to it
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// openOutput returns the file at path to write to, stdout if path is empty
+// or -
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+// writeJSON writes v to w as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// runOnce runs a single pass
+func runOnce(ctx context.Context, logger *log.Entry, service *indexer.Indexer, args []string) int {
+	flags := flag.NewFlagSet("once", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		return exitUsage
+	}
+	return runExitCode(logger, service.Run(ctx))
+}
+
+// runBackfill captures the snapshots over a height range
+func runBackfill(ctx context.Context, logger *log.Entry, service *indexer.Indexer, args []string) int {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	from := flags.Int64("from", 0, "First height to capture")
+	to := flags.Int64("to", 0, "Last height to capture")
+	step := flags.Int64("step", 3600, "Blocks between captures")
+	err := flags.Parse(args)
+	if err != nil {
+		return exitUsage
+	}
+	if *from <= 0 || *to < *from || *step <= 0 {
+		fmt.Fprintln(os.Stderr, "backfill needs --from and --to with --from <= --to, and a positive --step")
+		return exitUsage
+	}
+	return runExitCode(logger, service.Backfill(ctx, *from, *to, *step))
+}
+
+// runVerify checks a captured snapshot against the contract state
+func runVerify(ctx context.Context, logger *log.Entry, service *indexer.Indexer, args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	height := flags.Int64("height", 0, "Height of the snapshot to verify, the latest if not set")
+	err := flags.Parse(args)
+	if err != nil {
+		return exitUsage
+	}
+
+	verification, err := service.Verify(ctx, *height)
+	if err != nil {
+		logger.Errorf("Unable to verify snapshot: %v", err)
+		return exitFailure
+	}
+	writeJSON(os.Stdout, verification)
+	if verification.Status != indexer.VerificationVerified {
+		return exitFailure
+	}
+	return exitStopped
+}
+
+// runExport writes datasets to a file or stdout, or to a directory along
+// with a manifest of their row counts and checksums
+func runExport(ctx context.Context, logger *log.Entry, service *indexer.Indexer, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	datasets := flags.String("dataset", "", "Datasets to export, comma separated: leaderboard, history, stats, datom or all")
+	format := flags.String("format", indexer.FormatNDJSON, "Format: ndjson, csv or parquet")
+	height := flags.Int64("height", 0, "Single height to export, the leaderboard at that height")
+	fromHeight := flags.Int64("from-height", 0, "First height to export")
+	toHeight := flags.Int64("to-height", 0, "Last height to export")
+	fromDate := flags.String("from-date", "", "First block date to export, YYYY-MM-DD or RFC3339")
+	toDate := flags.String("to-date", "", "Last block date to export, YYYY-MM-DD or RFC3339")
+	address := flags.String("address", "", "Address to export the history of")
+	out := flags.String("out", "", "File to write a single dataset to, stdout if not set")
+	dir := flags.String("dir", "", "Directory to write every dataset and the manifest to")
+	err := flags.Parse(args)
+	if err != nil {
+		return exitUsage
+	}
+
+	names := strings.Split(*datasets, ",")
+	if *datasets == "all" {
+		names = indexer.ExportDatasets
+	}
+	filter, err := exportFilter(*height, *fromHeight, *toHeight, *fromDate, *toDate, *address)
+	if err == nil {
+		for _, name := range names {
+			err = indexer.ValidateExport(name, *format, filter)
+			if err != nil {
+				break
+			}
+		}
+	}
+	if err == nil && *dir == "" && len(names) > 1 {
+		err = errors.New("exporting more than one dataset needs a --dir")
+	}
+	if err == nil && *dir != "" && *out != "" {
+		err = errors.New("export takes either --out or --dir")
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "export: %v\n", err)
+		return exitUsage
+	}
+
+	if *dir == "" {
+		output, err := openOutput(*out)
+		if err != nil {
+			logger.Errorf("Unable to open output: %v", err)
+			return exitFailure
+		}
+		defer output.Close()
+
+		file, err := service.Export(ctx, output, names[0], *format, filter)
+		if err != nil {
+			return runExitCode(logger, err)
+		}
+		logger.WithFields(log.Fields{
+			"dataset": file.Dataset,
+			"format":  file.Format,
+			"rows":    file.Rows,
+			"bytes":   file.Bytes,
+			"sha256":  file.SHA256,
+		}).Info("Exported")
+		return exitStopped
+	}
+
+	err = os.MkdirAll(*dir, 0o755)
+	if err != nil {
+		logger.Errorf("Unable to create export directory: %v", err)
+		return exitFailure
+	}
+	manifest, err := service.ExportFiles(ctx, names, *format, filter, func(name string) (io.WriteCloser, error) {
+		return os.Create(filepath.Join(*dir, name))
+	})
+	if err != nil {
+		return runExitCode(logger, err)
+	}
+	for _, file := range manifest.Files {
+		logger.WithFields(log.Fields{
+			"file": file.File,
+			"rows": file.Rows,
+		}).Info("Exported")
+	}
+
+	output, err := os.Create(filepath.Join(*dir, "manifest.json"))
+	if err != nil {
+		logger.Errorf("Unable to create manifest: %v", err)
+		return exitFailure
+	}
+	defer output.Close()
+	err = writeJSON(output, manifest)
+	if err != nil {
+		logger.Errorf("Unable to write manifest: %v", err)
+		return exitFailure
+	}
+	return exitStopped
+}
+
+// exportFilter builds the filter of an export from its flags, resolving the
+// address to its Neutron address
+func exportFilter(height, fromHeight, toHeight int64, fromDate, toDate, address string) (indexer.ExportFilter, error) {
+	filter := indexer.ExportFilter{
+		FromHeight: fromHeight,
+		ToHeight:   toHeight,
+	}
+	if height > 0 {
+		if fromHeight > 0 || toHeight > 0 {
+			return filter, errors.New("--height can't be combined with --from-height or --to-height")
+		}
+		filter.FromHeight, filter.ToHeight = height, height
+	}
+	var err error
+	if fromDate != "" {
+		filter.Since, err = indexer.ParseExportDate(fromDate, false)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --from-date: %v", err)
+		}
+	}
+	if toDate != "" {
+		filter.Until, err = indexer.ParseExportDate(toDate, true)
+		if err != nil {
+			return filter, fmt.Errorf("invalid --to-date: %v", err)
+		}
+	}
+	if address != "" {
+		resolved, err := indexer.ResolveAddress(address)
+		if err != nil {
+			return filter, err
+		}
+		filter.Address = resolved.Address
+	}
+	return filter, nil
+}
+
+// runInspectAddress prints the history and live balance of an address
+func runInspectAddress(ctx context.Context, logger *log.Entry, service *indexer.Indexer, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "inspect-address needs an address")
+		return exitUsage
+	}
+
+	inspection, err := service.InspectAddress(ctx, args[0])
+	if err != nil {
+		return runExitCode(logger, err)
+	}
+	writeJSON(os.Stdout, inspection)
+	return exitStopped
+}
+
+// runCheckBalance compares the on-chain balance of an address at a height
+// with the stored one
+func runCheckBalance(ctx context.Context, logger *log.Entry, service *indexer.Indexer, args []string) int {
+	flags := flag.NewFlagSet("check-balance", flag.ContinueOnError)
+	height := flags.Int64("height", 0, "Height to check, the latest captured snapshot if not set")
+	lookup := flags.String("lookup", indexer.LookupSmart, "Lookup: smart for the cw20 balance query, raw for the contract state entry")
+
+	// The address may come before or after the flags
+	var address string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		address = args[0]
+		args = args[1:]
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return exitUsage
+	}
+	if address == "" && flags.NArg() == 1 {
+		address = flags.Arg(0)
+	}
+	if address == "" {
+		fmt.Fprintln(os.Stderr, "check-balance needs an address")
+		return exitUsage
+	}
+
+	check, err := service.CheckBalance(ctx, address, *height, *lookup)
+	if err != nil {
+		return runExitCode(logger, err)
+	}
+	writeJSON(os.Stdout, check)
+	if check.Status == indexer.BalanceMismatch || check.Status == indexer.BalanceMissing {
+		return exitFailure
+	}
+	return exitStopped
+}
+
+// runReprocess re-derives the snapshots from the archived contract state
+func runReprocess(ctx context.Context, logger *log.Entry, service *indexer.Indexer, args []string) int {
+	flags := flag.NewFlagSet("reprocess", flag.ContinueOnError)
+	height := flags.Int64("height", 0, "Height to reprocess")
+	from := flags.Int64("from", 0, "First height to reprocess")
+	to := flags.Int64("to", 0, "Last height to reprocess")
+	err := flags.Parse(args)
+	if err != nil {
+		return exitUsage
+	}
+	if *height > 0 {
+		if *from > 0 || *to > 0 {
+			fmt.Fprintln(os.Stderr, "reprocess takes either --height or --from and --to")
+			return exitUsage
+		}
+		*from, *to = *height, *height
+	}
+	if *from < 0 || *to < 0 || (*to > 0 && *to < *from) {
+		fmt.Fprintln(os.Stderr, "reprocess needs --from <= --to")
+		return exitUsage
+	}
+	return runExitCode(logger, service.Reprocess(ctx, *from, *to))
+}
+
+// runDumpState writes the decoded contract state at a height
+func runDumpState(ctx context.Context, logger *log.Entry, service *indexer.Indexer, args []string) int {
+	flags := flag.NewFlagSet("dump-state", flag.ContinueOnError)
+	height := flags.Int64("height", 0, "Height to dump, the latest if not set")
+	out := flags.String("out", "", "File to write to, stdout if not set")
+	err := flags.Parse(args)
+	if err != nil {
+		return exitUsage
+	}
+
+	state, err := service.State(ctx, *height)
+	if err != nil {
+		return runExitCode(logger, err)
+	}
+
+	output, err := openOutput(*out)
+	if err != nil {
+		logger.Errorf("Unable to open output: %v", err)
+		return exitFailure
+	}
+	defer output.Close()
+	err = writeJSON(output, state)
+	if err != nil {
+		logger.Errorf("Unable to write state: %v", err)
+		return exitFailure
+	}
+	return exitStopped
+}
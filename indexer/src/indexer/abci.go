@@ -0,0 +1,79 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	rpchttp "github.com/tendermint/tendermint/rpc/client/http"
+)
+
+// errABCIQueryFailed is the error of a query the node answered with a
+// non-zero code, ie. an unknown contract
+var errABCIQueryFailed = errors.New("ABCI query failed")
+
+// abciQuery performs the gRPC query at path over ABCI at height and decodes
+// the result into response. A zero height queries the latest block
+func (i *Indexer) abciQuery(ctx context.Context, path string, request proto.Message, height int64, response proto.Message) error {
+	client, err := rpchttp.New(i.rpcEndpoint)
+	if err != nil {
+		return permanentError(path, err)
+	}
+
+	rpcRequest, err := proto.Marshal(request)
+	if err != nil {
+		return permanentError(path, err)
+	}
+
+	rpcResponse, err := client.ABCIQueryWithOptions(
+		ctx,
+		path,
+		rpcRequest,
+		rpcclient.ABCIQueryOptions{Height: height, Prove: false},
+	)
+	if err != nil {
+		return requestError(path, err)
+	}
+	if rpcResponse.Response.Code != 0 {
+		observeABCIError(path, rpcResponse.Response.Code)
+		return permanentError(path, fmt.Errorf("%w with code %d: %s", errABCIQueryFailed,
+			rpcResponse.Response.Code, rpcResponse.Response.Log))
+	}
+
+	err = proto.Unmarshal(rpcResponse.Response.GetValue(), response)
+	if err != nil {
+		return dataError(path, err)
+	}
+	return nil
+}
+
+// latestHeight returns the height of the latest block known to the RPC
+func (i *Indexer) latestHeight(ctx context.Context) (int64, error) {
+	const op = "query latest height"
+	client, err := rpchttp.New(i.rpcEndpoint)
+	if err != nil {
+		return 0, permanentError(op, err)
+	}
+	status, err := client.Status(ctx)
+	if err != nil {
+		return 0, requestError(op, err)
+	}
+	return status.SyncInfo.LatestBlockHeight, nil
+}
+
+// blockTime returns the time of the block at height
+func (i *Indexer) blockTime(ctx context.Context, height int64) (time.Time, error) {
+	const op = "query block time"
+	client, err := rpchttp.New(i.rpcEndpoint)
+	if err != nil {
+		return time.Time{}, permanentError(op, err)
+	}
+	block, err := client.Block(ctx, &height)
+	if err != nil {
+		return time.Time{}, requestError(op, err)
+	}
+	return block.Block.Header.Time, nil
+}
@@ -0,0 +1,65 @@
+package indexer
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cosmos/btcutil/bech32"
+)
+
+// NeutronPrefix is the bech32 prefix of Neutron addresses
+const NeutronPrefix = "neutron"
+
+// accountLength is the length of an address derived from a secp256k1 key.
+// Contract addresses are longer and can't be derived across chains
+const accountLength = 20
+
+// CoinType118Prefixes are the bech32 prefixes of chains that derive their
+// accounts with coin type 118, the same as Neutron. The same key gives the
+// same account bytes on all of them
+var CoinType118Prefixes = []string{
+	"akash", "axelar", "celestia", "cosmos", "dydx", "juno", "kujira",
+	"migaloo", "neutron", "noble", "osmo", "stars", "stride", "umee",
+}
+
+// ResolvedAddress is a lookup address resolved to its Neutron address
+type ResolvedAddress struct {
+	Input   string `json:"input"`
+	Prefix  string `json:"prefix"`
+	Address string `json:"address"`
+	Derived bool   `json:"derived"`
+}
+
+// ResolveAddress validates a bech32 address from any coin type 118 chain and
+// re-encodes it with the Neutron prefix
+func ResolveAddress(input string) (ResolvedAddress, error) {
+	resolved := ResolvedAddress{
+		Input: strings.TrimSpace(input),
+	}
+
+	prefix, account, err := bech32.DecodeToBase256(resolved.Input)
+	if err != nil {
+		return resolved, fmt.Errorf("invalid bech32 address: %v", err)
+	}
+	resolved.Prefix = prefix
+
+	if prefix == NeutronPrefix {
+		resolved.Address = strings.ToLower(resolved.Input)
+		return resolved, nil
+	}
+	if !containsString(CoinType118Prefixes, prefix) {
+		return resolved, fmt.Errorf("addresses with prefix %q can't be derived, supported prefixes are %s",
+			prefix, strings.Join(CoinType118Prefixes, ", "))
+	}
+	if len(account) != accountLength {
+		return resolved, fmt.Errorf("only account addresses can be derived, %q is a %d byte address",
+			resolved.Input, len(account))
+	}
+
+	resolved.Address, err = bech32.EncodeFromBase256(NeutronPrefix, account)
+	if err != nil {
+		return resolved, err
+	}
+	resolved.Derived = true
+	return resolved, nil
+}
@@ -0,0 +1,47 @@
+package indexer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestResolveAddress(t *testing.T) {
+	account := bytes.Repeat([]byte{1}, accountLength)
+	neutron := testAddress(t, NeutronPrefix, account)
+	contract := bytes.Repeat([]byte{2}, 32)
+	tests := []struct {
+		name    string
+		input   string
+		prefix  string
+		address string
+		derived bool
+		valid   bool
+	}{
+		{"neutron", neutron, NeutronPrefix, neutron, false, true},
+		{"neutron upper case", strings.ToUpper(neutron), NeutronPrefix, neutron, false, true},
+		{"surrounding space", " " + neutron + "\n", NeutronPrefix, neutron, false, true},
+		{"neutron contract", testAddress(t, NeutronPrefix, contract), NeutronPrefix, testAddress(t, NeutronPrefix, contract), false, true},
+		{"cosmos", testAddress(t, "cosmos", account), "cosmos", neutron, true, true},
+		{"osmosis", testAddress(t, "osmo", account), "osmo", neutron, true, true},
+		{"unsupported prefix", testAddress(t, "terra", account), "terra", "", false, false},
+		{"foreign contract", testAddress(t, "osmo", contract), "osmo", "", false, false},
+		{"invalid checksum", neutron[:len(neutron)-1] + "q", "", "", false, false},
+		{"not bech32", "neutron", "", "", false, false},
+		{"empty", "", "", "", false, false},
+	}
+	for _, test := range tests {
+		resolved, err := ResolveAddress(test.input)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: ResolveAddress(%q) error %v, want valid %v", test.name, test.input, err, test.valid)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		if resolved.Prefix != test.prefix || resolved.Address != test.address || resolved.Derived != test.derived {
+			t.Errorf("%s: ResolveAddress(%q) = %s %s %v, want %s %s %v", test.name, test.input,
+				resolved.Prefix, resolved.Address, resolved.Derived, test.prefix, test.address, test.derived)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package indexer
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// anomalyHistory is the number of earlier snapshots the growth of the
+	// total Droplets is compared against
+	anomalyHistory = 30
+	// anomalyMinHistory is the number of growth rates needed before the
+	// growth guard applies
+	anomalyMinHistory = 5
+)
+
+// snapshotTotals returns the Droplets and addresses of a stored snapshot
+// including excluded addresses. Snapshots stored before the totals including
+// excluded addresses were kept fall back to the leaderboard totals
+func snapshotTotals(snapshot models.DropletStatsHistory) (int64, int64) {
+	if snapshot.TotalAddressesAll == 0 {
+		return snapshot.TotalDroplets, snapshot.TotalAddresses
+	}
+	return snapshot.TotalDropletsAll, snapshot.TotalAddressesAll
+}
+
+// growthRates returns the hourly growth of the total Droplets between each
+// of the snapshots, which are ordered newest first. Snapshots with the same
+// block date are skipped
+func growthRates(snapshots []models.DropletStatsHistory) []float64 {
+	var rates []float64
+	for index := 0; index+1 < len(snapshots); index++ {
+		hours := snapshots[index].DateBlock.Sub(snapshots[index+1].DateBlock).Hours()
+		if hours <= 0 {
+			continue
+		}
+		later, _ := snapshotTotals(snapshots[index])
+		earlier, _ := snapshotTotals(snapshots[index+1])
+		rates = append(rates, float64(later-earlier)/hours)
+	}
+	return rates
+}
+
+// growthRange returns the range of rates widened by factor on both sides.
+// Rates must not be empty
+func growthRange(rates []float64, factor float64) (float64, float64) {
+	lowest, highest := rates[0], rates[0]
+	for _, rate := range rates[1:] {
+		lowest = math.Min(lowest, rate)
+		highest = math.Max(highest, rate)
+	}
+	lower := lowest / factor
+	if lowest < 0 {
+		lower = lowest * factor
+	}
+	upper := highest * factor
+	if highest < 0 {
+		upper = highest / factor
+	}
+	return lower, upper
+}
+
+// snapshotHeld returns true if the snapshot at height is quarantined and
+// hasn't been approved
+func (i *Indexer) snapshotHeld(height int64) (bool, error) {
+	var quarantine models.SnapshotQuarantine
+	result := i.db.Where("height = ?", height).First(&quarantine)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+		return false, result.Error
+	}
+	return !quarantine.Approved, nil
+}
+
+// snapshotApproved returns true if the snapshot at height was quarantined and
+// then approved
+func (i *Indexer) snapshotApproved(height int64) (bool, error) {
+	var count int64
+	result := i.db.Model(&models.SnapshotQuarantine{}).
+		Where("height = ? AND approved = ?", height, true).
+		Count(&count)
+	return count > 0, result.Error
+}
+
+// approvedUncaptured returns the approved quarantined snapshots below height
+// that haven't been captured, oldest first
+func (i *Indexer) approvedUncaptured(height int64) ([]int64, error) {
+	var heights []int64
+	result := i.db.Model(&models.SnapshotQuarantine{}).
+		Where("approved = ? AND height < ?", true, height).
+		Where("height NOT IN (?)", i.db.Model(&models.DropletStatsHistory{}).Select("height")).
+		Order("height ASC").
+		Pluck("height", &heights)
+	return heights, result.Error
+}
+
+// checkSnapshot compares a scanned snapshot with the ones stored before it
+// and returns the reasons it looks wrong, if any
+func (i *Indexer) checkSnapshot(state ContractState, dropAtom uint64, dateBlock time.Time) ([]string, error) {
+	var snapshots []models.DropletStatsHistory
+	result := i.db.Where("height < ?", state.Height).
+		Order("height DESC").
+		Limit(anomalyHistory + 1).
+		Find(&snapshots)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if len(snapshots) == 0 {
+		// Nothing to compare the first snapshot with
+		return nil, nil
+	}
+	previous := snapshots[0]
+	previousDroplets, previousAddresses := snapshotTotals(previous)
+
+	var reasons []string
+
+	// The number of addresses shouldn't shrink, a drop points to a partial
+	// scan
+	addresses := int64(len(state.Droplets))
+	if previousAddresses > 0 {
+		drop := float64(previousAddresses-addresses) / float64(previousAddresses)
+		if drop > i.anomalyMaxAddressDrop {
+			reasons = append(reasons, fmt.Sprintf(
+				"address count dropped from %d to %d", previousAddresses, addresses))
+		}
+	}
+
+	// Droplets only accrue, an address with fewer than before points to the
+	// wrong height or a misbehaving RPC
+	var history []models.DropletAddressHistory
+	result = i.db.Select("address, droplets").
+		Where("height = ?", previous.Height).
+		Find(&history)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	previousBalances := make(map[string]uint64, len(history))
+	for _, item := range history {
+		previousBalances[item.Address] = item.Droplets
+	}
+	var droplets int64
+	falling := 0
+	for _, account := range state.Droplets {
+		droplets += int64(account.Droplets)
+		balance, ok := previousBalances[account.Address]
+		if ok && account.Droplets < balance {
+			falling++
+		}
+	}
+	if falling > i.anomalyMaxFallingBalances {
+		reasons = append(reasons, fmt.Sprintf(
+			"%d addresses have fewer Droplets than at height %d", falling, previous.Height))
+	}
+
+	// The total Droplets should grow at a rate close to the earlier
+	// snapshots. Rates are per hour since snapshots aren't evenly spaced
+	rates := growthRates(snapshots)
+	hours := dateBlock.Sub(previous.DateBlock).Hours()
+	if len(rates) >= anomalyMinHistory && hours > 0 {
+		lower, upper := growthRange(rates, i.anomalyGrowthRangeFactor)
+		rate := float64(droplets-previousDroplets) / hours
+		if rate < lower || rate > upper {
+			reasons = append(reasons, fmt.Sprintf(
+				"total Droplets grew by %d (%.0f per hour), outside of %.0f to %.0f per hour",
+				droplets-previousDroplets, rate, lower, upper))
+		}
+	}
+
+	// A sharp move of the dATOM total points to a bad query response
+	var previousAtom models.DropAtomHistory
+	result = i.db.Where("height < ?", state.Height).Order("height DESC").First(&previousAtom)
+	if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+		return nil, result.Error
+	}
+	if previousAtom.TotalAtom > 0 {
+		change := math.Abs(float64(dropAtom)-float64(previousAtom.TotalAtom)) / float64(previousAtom.TotalAtom)
+		if change > i.anomalyMaxDropAtomChange {
+			reasons = append(reasons, fmt.Sprintf(
+				"dATOM total moved %.1f%% from %d to %d", change*100, previousAtom.TotalAtom, dropAtom))
+		}
+	}
+
+	return reasons, nil
+}
+
+// quarantineSnapshot stores a snapshot that failed the anomaly guards for
+// review
+func (i *Indexer) quarantineSnapshot(state ContractState, dropAtom uint64, dateBlock time.Time, reasons []string) error {
+	var droplets int64
+	for _, account := range state.Droplets {
+		droplets += int64(account.Droplets)
+	}
+
+	quarantine := models.SnapshotQuarantine{
+		Height:         state.Height,
+		Reasons:        strings.Join(reasons, "; "),
+		TotalDroplets:  droplets,
+		TotalAddresses: int64(len(state.Droplets)),
+		TotalAtom:      dropAtom,
+		DateBlock:      dateBlock,
+		DateCreated:    time.Now(),
+	}
+	return i.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&quarantine).Error
+}
@@ -0,0 +1,84 @@
+package indexer
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+)
+
+func TestSnapshotTotals(t *testing.T) {
+	tests := []struct {
+		name      string
+		snapshot  models.DropletStatsHistory
+		droplets  int64
+		addresses int64
+	}{
+		{
+			name:      "including excluded addresses",
+			snapshot:  models.DropletStatsHistory{TotalDroplets: 100, TotalAddresses: 2, TotalDropletsAll: 150, TotalAddressesAll: 3},
+			droplets:  150,
+			addresses: 3,
+		},
+		{
+			name:      "stored before the totals were kept",
+			snapshot:  models.DropletStatsHistory{TotalDroplets: 100, TotalAddresses: 2},
+			droplets:  100,
+			addresses: 2,
+		},
+	}
+	for _, test := range tests {
+		droplets, addresses := snapshotTotals(test.snapshot)
+		if droplets != test.droplets || addresses != test.addresses {
+			t.Errorf("%s: snapshotTotals = %d, %d, want %d, %d",
+				test.name, droplets, addresses, test.droplets, test.addresses)
+		}
+	}
+}
+
+func TestGrowthRates(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := []models.DropletStatsHistory{
+		{DateBlock: start.Add(4 * time.Hour), TotalDroplets: 400, TotalDropletsAll: 420, TotalAddressesAll: 5},
+		{DateBlock: start.Add(2 * time.Hour), TotalDroplets: 200},
+		{DateBlock: start.Add(2 * time.Hour), TotalDroplets: 190},
+		{DateBlock: start, TotalDroplets: 100},
+	}
+	want := []float64{110, 45}
+
+	rates := growthRates(snapshots)
+	if len(rates) != len(want) {
+		t.Fatalf("growthRates = %v, want %v", rates, want)
+	}
+	for index := range want {
+		if math.Abs(rates[index]-want[index]) > 1e-9 {
+			t.Errorf("growthRates = %v, want %v", rates, want)
+			break
+		}
+	}
+	if rates := growthRates(snapshots[:1]); len(rates) != 0 {
+		t.Errorf("growthRates of a single snapshot = %v, want none", rates)
+	}
+}
+
+func TestGrowthRange(t *testing.T) {
+	tests := []struct {
+		rates []float64
+		lower float64
+		upper float64
+	}{
+		{[]float64{15}, 5, 45},
+		{[]float64{10, 30, 20}, 10.0 / 3, 90},
+		{[]float64{20, -10}, -30, 60},
+		{[]float64{-30, -10}, -90, -10.0 / 3},
+		{[]float64{0, 0}, 0, 0},
+	}
+	for _, test := range tests {
+		lower, upper := growthRange(test.rates, 3)
+		if math.Abs(lower-test.lower) > 1e-9 || math.Abs(upper-test.upper) > 1e-9 {
+			t.Errorf("growthRange(%v, 3) = %v, %v, want %v, %v",
+				test.rates, lower, upper, test.lower, test.upper)
+		}
+	}
+}
@@ -0,0 +1,466 @@
+package indexer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/gogo/protobuf/proto"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Where the raw contract state is archived
+const (
+	// ArchiveNone doesn't archive the raw contract state
+	ArchiveNone = ""
+	// ArchiveDisk writes a file per height to STATE_ARCHIVE_DIR
+	ArchiveDisk = "disk"
+	// ArchiveDB stores a row per height in contract_state_archive
+	ArchiveDB = "db"
+)
+
+// archiveExtension is the extension of the archive files, gzip compressed
+// protobuf
+const archiveExtension = ".pb.gz"
+
+// tokenInfoKey is the raw key of the cw20 token info Item
+const tokenInfoKey = "token_info"
+
+// archivePath returns the archive file of height
+func (i *Indexer) archivePath(height int64) string {
+	return filepath.Join(i.stateArchiveDir, strconv.FormatInt(height, 10)+archiveExtension)
+}
+
+// encodeArchive compresses the raw keys and values of a contract state
+func encodeArchive(stateModels []Model) ([]byte, error) {
+	data, err := proto.Marshal(&QueryAllContractStateResponse{Models: stateModels})
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err = writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// decodeArchive returns the raw keys and values of an archived contract state
+func decodeArchive(archive []byte) ([]Model, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	var response QueryAllContractStateResponse
+	err = proto.Unmarshal(data, &response)
+	if err != nil {
+		return nil, err
+	}
+	return response.Models, nil
+}
+
+// archiveState stores the raw keys and values of state, replacing an earlier
+// archive of its height
+func (i *Indexer) archiveState(ctx context.Context, state ContractState) error {
+	const op = "archive state"
+	archive, err := encodeArchive(state.Models)
+	if err != nil {
+		return permanentError(op, err)
+	}
+
+	switch i.stateArchive {
+	case ArchiveDisk:
+		err = os.MkdirAll(i.stateArchiveDir, 0o755)
+		if err != nil {
+			return permanentError(op, err)
+		}
+		// Write to a temporary file first so a failure doesn't leave a
+		// partial archive behind
+		path := i.archivePath(state.Height)
+		err = os.WriteFile(path+".tmp", archive, 0o644)
+		if err != nil {
+			return permanentError(op, err)
+		}
+		err = os.Rename(path+".tmp", path)
+		if err != nil {
+			return permanentError(op, err)
+		}
+	case ArchiveDB:
+		checksum := sha256.Sum256(archive)
+		row := models.ContractStateArchive{
+			Height:      state.Height,
+			Keys:        int64(len(state.Models)),
+			Data:        archive,
+			SHA256:      hex.EncodeToString(checksum[:]),
+			DateCreated: time.Now(),
+		}
+		result := i.db.WithContext(ctx).Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "height"}},
+			DoUpdates: clause.AssignmentColumns([]string{"keys", "data", "sha256", "date_created"}),
+		}).Create(&row)
+		if result.Error != nil {
+			return dbError(op, result.Error)
+		}
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"height": state.Height,
+		"keys":   len(state.Models),
+		"bytes":  len(archive),
+	}).Info("Contract state archived")
+	return nil
+}
+
+// loadArchive returns the archived raw keys and values at height
+func (i *Indexer) loadArchive(ctx context.Context, height int64) ([]Model, error) {
+	const op = "load archive"
+	var archive []byte
+	switch i.stateArchive {
+	case ArchiveDisk:
+		var err error
+		archive, err = os.ReadFile(i.archivePath(height))
+		if err != nil {
+			return nil, permanentError(op, err)
+		}
+	case ArchiveDB:
+		var row models.ContractStateArchive
+		result := i.db.WithContext(ctx).Where("height = ?", height).First(&row)
+		if result.Error != nil {
+			return nil, dbError(op, result.Error)
+		}
+		checksum := sha256.Sum256(row.Data)
+		if hex.EncodeToString(checksum[:]) != row.SHA256 {
+			return nil, dataError(op, fmt.Errorf("checksum mismatch of the archive at height %d", height))
+		}
+		archive = row.Data
+	default:
+		return nil, permanentError(op, errors.New("STATE_ARCHIVE is not set"))
+	}
+
+	stateModels, err := decodeArchive(archive)
+	if err != nil {
+		return nil, dataError(op, err)
+	}
+	return stateModels, nil
+}
+
+// archivedHeights returns the heights with an archived contract state from
+// from to to, every height when both are zero
+func (i *Indexer) archivedHeights(ctx context.Context, from int64, to int64) ([]int64, error) {
+	const op = "list archives"
+	var heights []int64
+	switch i.stateArchive {
+	case ArchiveDisk:
+		entries, err := os.ReadDir(i.stateArchiveDir)
+		if err != nil {
+			return nil, permanentError(op, err)
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), archiveExtension)
+			if !ok {
+				continue
+			}
+			height, err := strconv.ParseInt(name, 10, 64)
+			if err != nil {
+				continue
+			}
+			heights = append(heights, height)
+		}
+	case ArchiveDB:
+		result := i.db.WithContext(ctx).Model(&models.ContractStateArchive{}).Pluck("height", &heights)
+		if result.Error != nil {
+			return nil, dbError(op, result.Error)
+		}
+	default:
+		return nil, permanentError(op, errors.New("STATE_ARCHIVE is not set"))
+	}
+
+	selected := heights[:0]
+	for _, height := range heights {
+		if (from == 0 || height >= from) && (to == 0 || height <= to) {
+			selected = append(selected, height)
+		}
+	}
+	sort.Slice(selected, func(a, b int) bool { return selected[a] < selected[b] })
+	return selected, nil
+}
+
+// stateTotalSupply reads the cw20 total supply from the token info in the raw
+// contract state
+func stateTotalSupply(stateModels []Model) (uint64, error) {
+	for _, model := range stateModels {
+		if string(model.Key) != tokenInfoKey {
+			continue
+		}
+		var tokenInfo tokenInfoResponse
+		err := json.Unmarshal(model.Value, &tokenInfo)
+		if err != nil {
+			return 0, fmt.Errorf("unable to parse token info: %v", err)
+		}
+		return strconv.ParseUint(tokenInfo.TotalSupply, 10, 64)
+	}
+	return 0, errors.New("no token info in the contract state")
+}
+
+// Reprocess re-derives the snapshots from the archived contract state with
+// the current decoding rules, without querying the chain. Every archived and
+// captured height from from to to, all of them when both are zero, has its
+// history, exclusions, stats, quarantined keys, distribution and rank tiers
+// replaced, and its dATOM total kept. The leaderboard is replaced only by
+// the latest snapshot. The tables derived from the history are recomputed
+// from the first reprocessed height on
+func (i *Indexer) Reprocess(ctx context.Context, from int64, to int64) error {
+	heights, err := i.archivedHeights(ctx, from, to)
+	if err != nil {
+		return err
+	}
+
+	var lastCapture models.DropletStatsHistory
+	result := i.db.Order("height DESC").First(&lastCapture)
+	if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+		return dbError("fetch last stats", result.Error)
+	}
+
+	skiplist, err := i.loadSkiplist()
+	if err != nil {
+		return dbError("load skiplist", err)
+	}
+
+	reprocessed := 0
+	var first int64
+	for _, height := range heights {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		ok, err := i.reprocessHeight(ctx, height, height == lastCapture.Height, skiplist)
+		if err != nil {
+			return err
+		}
+		if ok {
+			if reprocessed == 0 {
+				first = height
+			}
+			reprocessed++
+		}
+	}
+	if reprocessed > 0 {
+		err = i.rederive(ctx, first, lastCapture)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Recompute the distributions and rank tiers removed above
+	err = i.updateDistributions()
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to update distributions")
+	}
+	err = i.updateRankTiers()
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to update rank tiers")
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"archived":    len(heights),
+		"reprocessed": reprocessed,
+	}).Info("Reprocess finished")
+	return nil
+}
+
+// reprocessHeight replaces the snapshot at height with the one decoded from
+// its archive. Heights that weren't captured are skipped, returning false
+func (i *Indexer) reprocessHeight(ctx context.Context, height int64, publish bool, skiplist *Skiplist) (bool, error) {
+	// The block date comes from the captured snapshot, and its dATOM total
+	// is kept as it was
+	var previous models.DropletStatsHistory
+	result := i.db.WithContext(ctx).Where("height = ?", height).First(&previous)
+	if result.Error == gorm.ErrRecordNotFound {
+		i.logger.WithFields(logrus.Fields{
+			"height": height,
+		}).Warn("Skipping archive of a height that wasn't captured")
+		return false, nil
+	}
+	if result.Error != nil {
+		return false, dbError("fetch stats", result.Error)
+	}
+
+	stateModels, err := i.loadArchive(ctx, height)
+	if err != nil {
+		return false, err
+	}
+	page := decodeStateModels(stateModels)
+	state := ContractState{
+		Height:      height,
+		Keys:        page.Keys,
+		BalanceKeys: page.BalanceKeys,
+		Droplets:    page.Droplets,
+		Quarantined: page.Quarantined,
+	}
+	// The total supply is read from the archive, or the one stored when the
+	// snapshot was verified, so verifying doesn't query the chain
+	state.TotalSupply, err = stateTotalSupply(stateModels)
+	if err != nil {
+		if previous.TotalSupply > 0 {
+			i.logger.WithFields(logrus.Fields{
+				"height": height,
+				"err":    err,
+			}).Warn("Verifying against the stored total supply")
+			state.TotalSupply = uint64(previous.TotalSupply)
+		} else {
+			state.supplyErr = err
+		}
+	}
+
+	run := &models.IndexerRun{}
+	err = i.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{
+			&models.DropletAddressHistory{},
+			&models.DropletExclusionHistory{},
+			&models.DropletStatsHistory{},
+			&models.DropletKeyQuarantine{},
+			&models.DropletDistributionHistory{},
+			&models.DropletRankTier{},
+		} {
+			result := tx.Where("height = ?", height).Delete(model)
+			if result.Error != nil {
+				return dbError("clear snapshot", result.Error)
+			}
+		}
+		return i.storeSnapshot(ctx, tx, run, state, nil, previous.DateBlock, skiplist, publish)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	err = i.storeQuarantinedKeys(height, state.Quarantined)
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to store quarantined keys")
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"height":                height,
+		"addresses":             len(state.Droplets),
+		"quarantined":           len(state.Quarantined),
+		"previous_total_all":    previous.TotalDropletsAll,
+		"previous_addresses":    previous.TotalAddressesAll,
+		"previous_verification": previous.VerificationStatus,
+	}).Info("Snapshot reprocessed")
+	return true, nil
+}
+
+// rederive recomputes the tables derived from the history of the snapshots
+// from height from on. Statuses and cohorts build on the snapshots before
+// them and positions on the previous interval, so every later height is
+// recomputed along with the reprocessed ones. The earning rates are refitted
+// at the last capture
+func (i *Indexer) rederive(ctx context.Context, from int64, lastCapture models.DropletStatsHistory) error {
+	var positionHeights []int64
+	result := i.db.WithContext(ctx).Model(&models.DropletAddressPosition{}).
+		Where("height >= ?", from).
+		Distinct("height").
+		Order("height").
+		Pluck("height", &positionHeights)
+	if result.Error != nil {
+		return dbError("fetch position heights", result.Error)
+	}
+
+	// Clear the rows together, the passes below and the next regular pass
+	// recompute any snapshot without them
+	err := i.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, model := range []any{
+			&models.DropletAddressStatus{},
+			&models.DropletStatusHistory{},
+			&models.DropletCohort{},
+			&models.EntityHistory{},
+		} {
+			result := tx.Where("height >= ?", from).Delete(model)
+			if result.Error != nil {
+				return dbError("clear derived tables", result.Error)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, height := range positionHeights {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var snapshot models.DropletStatsHistory
+		result = i.db.WithContext(ctx).Where("height = ?", height).First(&snapshot)
+		if result.Error == gorm.ErrRecordNotFound {
+			continue
+		}
+		if result.Error != nil {
+			return dbError("fetch stats", result.Error)
+		}
+		err = i.updatePositions(height, snapshot.DateBlock)
+		if err != nil {
+			i.logger.WithFields(logrus.Fields{
+				"height": height,
+				"err":    err,
+			}).Error("Unable to update positions")
+		}
+	}
+
+	// Classify the addresses again and extend the cohorts, entities and
+	// earning rates from them
+	err = i.updateAddressStatuses()
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to update address statuses")
+	}
+	err = i.updateCohorts()
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to update cohorts")
+	}
+	err = i.updateEntities()
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to update entities")
+	}
+	err = i.updateEarningRates(lastCapture.Height, lastCapture.DateBlock)
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to update earning rates")
+	}
+	return nil
+}
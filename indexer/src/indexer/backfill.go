@@ -0,0 +1,124 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+)
+
+// Backfill captures a snapshot every step blocks from height from to height
+// to, recording each in the run ledger. Heights already captured or held in
+// the quarantine are skipped. Only a snapshot newer than the last one
+// captured replaces the leaderboard, older ones are added to the history.
+// Backfill stops on the first failed height so it can be run again
+func (i *Indexer) Backfill(ctx context.Context, from int64, to int64, step int64) error {
+	if from <= 0 || to < from || step <= 0 {
+		return permanentError("backfill", fmt.Errorf("invalid range %d to %d every %d blocks", from, to, step))
+	}
+
+	var lastCapture models.DropletStatsHistory
+	result := i.db.Order("height DESC").First(&lastCapture)
+	if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+		return dbError("fetch last stats", result.Error)
+	}
+
+	captured := 0
+	skipped := 0
+	quarantined := 0
+	for height := from; height <= to; height += step {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var count int64
+		result = i.db.Model(&models.DropletStatsHistory{}).Where("height = ?", height).Count(&count)
+		if result.Error != nil {
+			return dbError("check captured height", result.Error)
+		}
+		held, err := i.snapshotHeld(height)
+		if err != nil {
+			return dbError("check snapshot quarantine", err)
+		}
+		if count > 0 || held {
+			i.logger.WithFields(logrus.Fields{
+				"height": height,
+				"held":   held,
+			}).Info("Skipping height")
+			skipped++
+			continue
+		}
+
+		outcome, err := i.backfillHeight(ctx, height, height > lastCapture.Height)
+		if err != nil {
+			return err
+		}
+		if outcome == models.IndexerRunQuarantined {
+			quarantined++
+			continue
+		}
+		if height > lastCapture.Height {
+			lastCapture.Height = height
+		}
+		captured++
+	}
+
+	// The distributions and rank tiers fill in every snapshot without them.
+	// Statuses, cohorts, earning rates and positions build on the latest
+	// snapshot, so they aren't recomputed for backfilled heights
+	err := i.updateDistributions()
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to update distributions")
+	}
+	err = i.updateRankTiers()
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to update rank tiers")
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"captured":    captured,
+		"skipped":     skipped,
+		"quarantined": quarantined,
+	}).Info("Backfill finished")
+	return nil
+}
+
+// backfillHeight captures the snapshot at height as a pass of its own and
+// returns its outcome
+func (i *Indexer) backfillHeight(ctx context.Context, height int64, publish bool) (string, error) {
+	ctx, span := tracer.Start(ctx, "backfill")
+	run := i.startRun()
+	run.Height = height
+
+	err := i.retry(ctx, "query block time", func() error {
+		dateBlock, err := i.blockTime(ctx, height)
+		if err != nil {
+			return err
+		}
+		run.DateOnchainUpdate = &dateBlock
+		return nil
+	})
+	if err == nil {
+		i.logger.WithFields(logrus.Fields{
+			"height":  height,
+			"date":    run.DateOnchainUpdate,
+			"publish": publish,
+		}).Info("Backfilling height")
+		err = i.capture(ctx, run, height, *run.DateOnchainUpdate, publish)
+	}
+	i.finishRun(run, err)
+
+	span.SetAttributes(
+		attribute.String("outcome", run.Outcome),
+		attribute.Int64("height", height),
+	)
+	endSpan(span, err)
+	return run.Outcome, err
+}
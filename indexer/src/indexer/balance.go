@@ -0,0 +1,170 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"gorm.io/gorm"
+)
+
+// Ways of looking up an on-chain balance
+const (
+	// LookupSmart runs the cw20 balance smart query
+	LookupSmart = "smart"
+	// LookupRaw reads the balance Map entry from the raw contract state, the
+	// same entry the indexer decodes when capturing
+	LookupRaw = "raw"
+)
+
+// Results of comparing an on-chain balance with the stored one
+const (
+	// BalanceMatch is a stored balance equal to the on-chain one
+	BalanceMatch = "match"
+	// BalanceMismatch is a stored balance different from the on-chain one
+	BalanceMismatch = "mismatch"
+	// BalanceMissing is an on-chain balance of an address not stored in the
+	// snapshot captured at the height
+	BalanceMissing = "missing"
+	// BalanceNotCaptured is a height without a captured snapshot
+	BalanceNotCaptured = "not_captured"
+)
+
+// BalanceCheck is the on-chain balance of an address at a height compared with
+// the balance stored in the snapshot at that height
+type BalanceCheck struct {
+	Address ResolvedAddress `json:"address"`
+	Height  int64           `json:"height"`
+	Lookup  string          `json:"lookup"`
+	// RawKey is the hex contract state key read by the raw lookup
+	RawKey string `json:"raw_key,omitempty"`
+	// OnChain is the balance on-chain, zero when the address has none
+	OnChain uint64 `json:"on_chain"`
+	// Stored is the balance stored for the snapshot, nil if the address isn't
+	// in it
+	Stored *AddressSnapshot `json:"stored"`
+	Status string           `json:"status"`
+	// Difference is the stored balance minus the on-chain balance
+	Difference int64 `json:"difference"`
+}
+
+// CheckBalance looks up the on-chain balance of input, resolved to its
+// Neutron address, at height and compares it with the stored history. A zero
+// height checks the latest captured snapshot
+func (i *Indexer) CheckBalance(ctx context.Context, input string, height int64, lookup string) (BalanceCheck, error) {
+	resolved, err := ResolveAddress(input)
+	if err != nil {
+		return BalanceCheck{}, permanentError("check balance", err)
+	}
+	if lookup == "" {
+		lookup = LookupSmart
+	}
+	if lookup != LookupSmart && lookup != LookupRaw {
+		return BalanceCheck{}, permanentError("check balance",
+			fmt.Errorf("unknown lookup %q, use %s or %s", lookup, LookupSmart, LookupRaw))
+	}
+
+	// Default to the latest captured snapshot
+	var snapshot models.DropletStatsHistory
+	query := i.db.WithContext(ctx).Order("height DESC")
+	if height > 0 {
+		query = query.Where("height = ?", height)
+	}
+	result := query.First(&snapshot)
+	if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+		return BalanceCheck{}, dbError("fetch snapshot", result.Error)
+	}
+	captured := result.Error == nil
+	if height == 0 {
+		if !captured {
+			return BalanceCheck{}, permanentError("check balance", fmt.Errorf("no snapshot captured yet"))
+		}
+		height = snapshot.Height
+	}
+
+	check := BalanceCheck{
+		Address: resolved,
+		Height:  height,
+		Lookup:  lookup,
+	}
+	switch lookup {
+	case LookupRaw:
+		check.RawKey = fmt.Sprintf("%X", encodeMapKey(balanceMapName, []byte(resolved.Address)))
+		check.OnChain, err = i.rawBalance(ctx, resolved.Address, height)
+	default:
+		check.OnChain, err = i.liveBalance(ctx, resolved.Address, height)
+	}
+	if err != nil {
+		return check, err
+	}
+
+	if !captured {
+		check.Status = BalanceNotCaptured
+		return check, nil
+	}
+
+	var row models.DropletAddressHistory
+	result = i.db.WithContext(ctx).
+		Where("address = ? AND height = ?", resolved.Address, height).
+		First(&row)
+	if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+		return check, dbError("fetch address history", result.Error)
+	}
+
+	var stored uint64
+	if result.Error == nil {
+		check.Stored = &AddressSnapshot{
+			Height:    row.Height,
+			Droplets:  row.Droplets,
+			Excluded:  row.Excluded,
+			DateBlock: row.DateBlock,
+		}
+		stored = row.Droplets
+	}
+	check.Difference = int64(stored) - int64(check.OnChain)
+
+	switch {
+	case check.Difference == 0:
+		check.Status = BalanceMatch
+	case check.Stored == nil:
+		check.Status = BalanceMissing
+	default:
+		check.Status = BalanceMismatch
+	}
+	return check, nil
+}
+
+// rawBalance reads the balance Map entry of address from the raw contract
+// state of the Droplets contract at height. An address without an entry has
+// no balance
+func (i *Indexer) rawBalance(ctx context.Context, address string, height int64) (uint64, error) {
+	const op = "query raw balance"
+
+	var balance uint64
+	err := i.retry(ctx, op, func() error {
+		var response QueryRawContractStateResponse
+		err := i.abciQuery(
+			ctx,
+			"/cosmwasm.wasm.v1.Query/RawContractState",
+			&QueryRawContractStateRequest{
+				Address:   i.dropletsContractAddress,
+				QueryData: encodeMapKey(balanceMapName, []byte(address)),
+			},
+			height,
+			&response,
+		)
+		if err != nil {
+			return err
+		}
+		if len(response.Data) == 0 {
+			balance = 0
+			return nil
+		}
+		balance, err = parseBalance(response.Data)
+		if err != nil {
+			return dataError(op, fmt.Errorf("invalid balance value %q: %v", response.Data, err))
+		}
+		return nil
+	})
+	return balance, err
+}
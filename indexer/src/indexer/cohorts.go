@@ -0,0 +1,115 @@
+package indexer
+
+import (
+	"sort"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// updateCohorts adds the cohort rows for every classified snapshot that
+// doesn't have them yet. Cohorts group addresses by the snapshot they were
+// first seen in, so this depends on the address statuses
+func (i *Indexer) updateCohorts() error {
+	var snapshots []models.DropletStatusHistory
+	result := i.db.Where("height NOT IN (?)",
+		i.db.Model(&models.DropletCohort{}).Select("height"),
+	).Order("height").Find(&snapshots)
+	if result.Error != nil {
+		return result.Error
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	// The size of every cohort is the number of new addresses in the
+	// snapshot it started at
+	var counts []models.DropletStatusHistory
+	result = i.db.Select("height, new").Find(&counts)
+	if result.Error != nil {
+		return result.Error
+	}
+	cohortSizes := make(map[int64]int64, len(counts))
+	for _, count := range counts {
+		cohortSizes[count.Height] = count.New
+	}
+
+	for _, snapshot := range snapshots {
+		var statuses []models.DropletAddressStatus
+		result = i.db.Select("first_seen_height, droplets").
+			Where("height = ? AND status <> ?", snapshot.Height, models.AddressStatusDropped).
+			Find(&statuses)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		cohorts := computeCohorts(snapshot, cohortSizes, statuses)
+		if len(cohorts) > 0 {
+			result = i.db.Create(&cohorts)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		i.logger.WithFields(logrus.Fields{
+			"height":  snapshot.Height,
+			"cohorts": len(cohorts),
+		}).Debug("Cohorts updated")
+	}
+	return nil
+}
+
+// computeCohorts returns the cohort rows of the snapshot given the size of
+// every cohort and the statuses of the addresses in the snapshot. Dropped
+// addresses must be excluded from the statuses. The rows are ordered by
+// cohort height
+func computeCohorts(snapshot models.DropletStatusHistory, cohortSizes map[int64]int64, statuses []models.DropletAddressStatus) []models.DropletCohort {
+	var total uint64
+	balances := make(map[int64][]uint64)
+	for _, status := range statuses {
+		balances[status.FirstSeenHeight] = append(balances[status.FirstSeenHeight], status.Droplets)
+		total += status.Droplets
+	}
+
+	// Every cohort up to the snapshot gets a row, one whose addresses
+	// have all dropped is retained by none of them
+	cohorts := make([]models.DropletCohort, 0, len(cohortSizes))
+	for cohortHeight, cohortSize := range cohortSizes {
+		if cohortHeight > snapshot.Height || cohortSize == 0 {
+			continue
+		}
+		cohortBalances := balances[cohortHeight]
+		sort.Slice(cohortBalances, func(a, b int) bool {
+			return cohortBalances[a] < cohortBalances[b]
+		})
+		var cohortTotal uint64
+		for _, balance := range cohortBalances {
+			cohortTotal += balance
+		}
+
+		cohort := models.DropletCohort{
+			CohortHeight: cohortHeight,
+			Height:       snapshot.Height,
+			CohortSize:   cohortSize,
+			Retained:     int64(len(cohortBalances)),
+			DateBlock:    snapshot.DateBlock,
+			DateCreated:  time.Now(),
+		}
+		if len(cohortBalances) > 0 {
+			cohort.MedianBalance = quantile(cohortBalances, 0.5)
+		}
+		if cohort.CohortSize > 0 {
+			cohort.Retention = float64(cohort.Retained) / float64(cohort.CohortSize)
+		}
+		if total > 0 {
+			cohort.DropletShare = float64(cohortTotal) / float64(total)
+		}
+		cohorts = append(cohorts, cohort)
+	}
+
+	sort.Slice(cohorts, func(a, b int) bool {
+		return cohorts[a].CohortHeight < cohorts[b].CohortHeight
+	})
+	return cohorts
+}
@@ -0,0 +1,70 @@
+package indexer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+)
+
+func TestComputeCohorts(t *testing.T) {
+	snapshot := models.DropletStatusHistory{Height: 300}
+	cohortSizes := map[int64]int64{
+		100: 4,
+		200: 2,
+		250: 0,
+		400: 5,
+	}
+	statuses := []models.DropletAddressStatus{
+		{FirstSeenHeight: 100, Droplets: 10},
+		{FirstSeenHeight: 100, Droplets: 30},
+		{FirstSeenHeight: 100, Droplets: 20},
+		{FirstSeenHeight: 300, Droplets: 40},
+	}
+	tests := []struct {
+		cohortHeight int64
+		size         int64
+		retained     int64
+		retention    float64
+		median       uint64
+		share        float64
+	}{
+		{100, 4, 3, 0.75, 20, 0.6},
+		{200, 2, 0, 0, 0, 0},
+	}
+
+	cohorts := computeCohorts(snapshot, cohortSizes, statuses)
+	if len(cohorts) != len(tests) {
+		t.Fatalf("computeCohorts returned %d cohorts, want %d", len(cohorts), len(tests))
+	}
+	for index, test := range tests {
+		cohort := cohorts[index]
+		if cohort.CohortHeight != test.cohortHeight || cohort.Height != snapshot.Height {
+			t.Errorf("cohort %d is %d at %d, want %d at %d",
+				index, cohort.CohortHeight, cohort.Height, test.cohortHeight, snapshot.Height)
+		}
+		if cohort.CohortSize != test.size || cohort.Retained != test.retained {
+			t.Errorf("cohort %d retained %d of %d, want %d of %d",
+				test.cohortHeight, cohort.Retained, cohort.CohortSize, test.retained, test.size)
+		}
+		if math.Abs(cohort.Retention-test.retention) > 1e-9 {
+			t.Errorf("cohort %d retention %v, want %v", test.cohortHeight, cohort.Retention, test.retention)
+		}
+		if cohort.MedianBalance != test.median {
+			t.Errorf("cohort %d median %d, want %d", test.cohortHeight, cohort.MedianBalance, test.median)
+		}
+		if math.Abs(cohort.DropletShare-test.share) > 1e-9 {
+			t.Errorf("cohort %d share %v, want %v", test.cohortHeight, cohort.DropletShare, test.share)
+		}
+	}
+}
+
+func TestComputeCohortsWithoutStatuses(t *testing.T) {
+	cohorts := computeCohorts(models.DropletStatusHistory{Height: 100}, map[int64]int64{100: 3}, nil)
+	if len(cohorts) != 1 {
+		t.Fatalf("computeCohorts returned %d cohorts, want 1", len(cohorts))
+	}
+	if cohorts[0].Retained != 0 || cohorts[0].Retention != 0 || cohorts[0].DropletShare != 0 {
+		t.Errorf("cohort without statuses = %+v, want nothing retained", cohorts[0])
+	}
+}
@@ -0,0 +1,144 @@
+package indexer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/cosmos/btcutil/bech32"
+	"github.com/tendermint/tendermint/libs/bytes"
+)
+
+// balanceMapName is the name of the cw-storage-plus Map holding the Droplet
+// balances in the contract state
+const balanceMapName = "balance"
+
+// StatePage is a page of decoded contract state
+type StatePage struct {
+	// LastKey is the raw key of the last entry in the page
+	LastKey []byte
+	// NextKey is the pagination key of the next page, empty on the last page
+	NextKey []byte
+	// Keys is the number of raw keys in the page
+	Keys int
+	// BalanceKeys is the number of raw keys in the balance Map
+	BalanceKeys int
+	// Droplets are the valid balances in the page
+	Droplets []AddressDroplets
+	// Quarantined are the balance keys or values that failed validation
+	Quarantined []QuarantinedKey
+	// Models are the raw keys and values of the page
+	Models []Model
+}
+
+// QuarantinedKey is a raw contract state entry that failed validation
+type QuarantinedKey struct {
+	Key    bytes.HexBytes `json:"key"`
+	Value  bytes.HexBytes `json:"value"`
+	Reason string         `json:"reason"`
+}
+
+// decodeMapKey splits a raw cw-storage-plus Map key into the map name and
+// the remaining key. Keys that aren't Map keys return false
+func decodeMapKey(key []byte) (string, []byte, bool) {
+	// Example of a key
+	// 00056465627473002B6F736D6F316379797A7078706C78647A6B656561376B777379646164673837333537716E6168616B616B7375696F6E
+	// The first two bytes "0007" indicate the length of the Map "name" -> 7 characters
+	// Followed by the map key "62616C616E6365" -> 'balance'
+	// Followed by the rest of the key, the address in this case
+	if len(key) < 2 {
+		return "", nil, false
+	}
+	length := int(binary.BigEndian.Uint16(key[0:2]))
+	if length == 0 || len(key) < 2+length {
+		return "", nil, false
+	}
+	return string(key[2 : 2+length]), key[2+length:], true
+}
+
+// encodeMapKey builds the raw cw-storage-plus key of key in the Map name, the
+// inverse of decodeMapKey
+func encodeMapKey(name string, key []byte) []byte {
+	raw := make([]byte, 2, 2+len(name)+len(key))
+	binary.BigEndian.PutUint16(raw, uint16(len(name)))
+	raw = append(raw, name...)
+	return append(raw, key...)
+}
+
+// parseBalance parses a raw balance value, a JSON string holding the amount
+// ie. "1234"
+func parseBalance(value []byte) (uint64, error) {
+	// Strip "" from the value which is represented as "1234"
+	amount := strings.ReplaceAll(string(value), "\"", "")
+	// Parse the value as a string into a uint64
+	return strconv.ParseUint(amount, 10, 64)
+}
+
+// validateAddress checks that raw is a Neutron bech32 address and returns it
+// normalised to lowercase
+func validateAddress(raw []byte) (string, error) {
+	address := string(raw)
+	prefix, _, err := bech32.DecodeToBase256(address)
+	if err != nil {
+		return "", fmt.Errorf("invalid bech32 address: %v", err)
+	}
+	if prefix != NeutronPrefix {
+		return "", fmt.Errorf("unexpected bech32 prefix %q", prefix)
+	}
+	return strings.ToLower(address), nil
+}
+
+// decodeStateModels decodes the Droplet balances from raw contract state.
+// Keys outside of the balance Map are ignored, balance entries that don't
+// hold a valid Neutron address and balance are quarantined
+func decodeStateModels(stateModels []Model) StatePage {
+	page := StatePage{
+		Keys: len(stateModels),
+	}
+
+	// Structure of raw state we are querying
+	// If a contract has a cw-storage-plus Map "balances" then the raw
+	// state keys for that Map will have "balances" as a prefix. Here we need
+	// to filter out all the keys we're interested in by looking for the
+	// prefix
+	// Example: A contract Map "balances" containing MARS addresses as keys
+	// will have contract state keys returned as "balancesmars..."
+	for _, model := range stateModels {
+		mapName, rawAddress, ok := decodeMapKey(model.Key)
+		if !ok || mapName != balanceMapName {
+			// Not a balance, ie. token info or allowances
+			continue
+		}
+		page.BalanceKeys++
+
+		address, err := validateAddress(rawAddress)
+		if err != nil {
+			page.Quarantined = append(page.Quarantined, QuarantinedKey{
+				Key:    model.Key,
+				Value:  model.Value,
+				Reason: err.Error(),
+			})
+			continue
+		}
+
+		balance, err := parseBalance(model.Value)
+		if err != nil {
+			page.Quarantined = append(page.Quarantined, QuarantinedKey{
+				Key:    model.Key,
+				Value:  model.Value,
+				Reason: fmt.Sprintf("invalid balance value: %v", err),
+			})
+			continue
+		}
+
+		page.Droplets = append(page.Droplets, AddressDroplets{
+			Address:  address,
+			Droplets: balance,
+		})
+	}
+	if len(stateModels) > 0 {
+		page.LastKey = stateModels[len(stateModels)-1].Key
+	}
+	return page
+}
@@ -0,0 +1,75 @@
+package indexer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMapKeyRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		key  []byte
+	}{
+		{"balance", []byte("neutron1cyyzpxplxdzkeea7kwsydadg87357qnahakaks")},
+		{"token_info", nil},
+		{"b", []byte{0x00, 0x01, 0xff}},
+	}
+	for _, test := range tests {
+		raw := encodeMapKey(test.name, test.key)
+		name, key, ok := decodeMapKey(raw)
+		if !ok {
+			t.Fatalf("decodeMapKey(%x) failed", raw)
+		}
+		if name != test.name || !bytes.Equal(key, test.key) {
+			t.Errorf("decodeMapKey(encodeMapKey(%q, %x)) = %q, %x", test.name, test.key, name, key)
+		}
+	}
+}
+
+func TestDecodeMapKey(t *testing.T) {
+	tests := []struct {
+		raw  []byte
+		name string
+		key  []byte
+		ok   bool
+	}{
+		{[]byte{0x00, 0x07, 'b', 'a', 'l', 'a', 'n', 'c', 'e', 'x'}, "balance", []byte("x"), true},
+		{[]byte{0x00, 0x02, 'a', 'b'}, "ab", []byte{}, true},
+		{nil, "", nil, false},
+		{[]byte{0x00}, "", nil, false},
+		{[]byte{0x00, 0x00, 'a'}, "", nil, false},
+		{[]byte{0x00, 0x05, 'a', 'b'}, "", nil, false},
+		{[]byte("token_info"), "", nil, false},
+	}
+	for _, test := range tests {
+		name, key, ok := decodeMapKey(test.raw)
+		if ok != test.ok || name != test.name || !bytes.Equal(key, test.key) {
+			t.Errorf("decodeMapKey(%x) = %q, %x, %v, want %q, %x, %v",
+				test.raw, name, key, ok, test.name, test.key, test.ok)
+		}
+	}
+}
+
+func TestParseBalance(t *testing.T) {
+	tests := []struct {
+		value  string
+		amount uint64
+		ok     bool
+	}{
+		{`"1234"`, 1234, true},
+		{`"0"`, 0, true},
+		{`1234`, 1234, true},
+		{`"18446744073709551615"`, 18446744073709551615, true},
+		{`"18446744073709551616"`, 0, false},
+		{`"-1"`, 0, false},
+		{`"12.5"`, 0, false},
+		{`""`, 0, false},
+		{`{"amount":"1"}`, 0, false},
+	}
+	for _, test := range tests {
+		amount, err := parseBalance([]byte(test.value))
+		if (err == nil) != test.ok || (test.ok && amount != test.amount) {
+			t.Errorf("parseBalance(%s) = %d, %v, want %d, ok %v", test.value, amount, err, test.amount, test.ok)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package indexer
+
+import (
+	"math"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// computeDistribution calculates the distribution metrics of balances,
+// which must be sorted in ascending order
+func computeDistribution(balances []uint64) models.DropletDistributionHistory {
+	n := len(balances)
+	distribution := models.DropletDistributionHistory{
+		Addresses: int64(n),
+	}
+	if n == 0 {
+		return distribution
+	}
+
+	var total, weighted float64
+	for index, balance := range balances {
+		total += float64(balance)
+		weighted += float64(index+1) * float64(balance)
+	}
+
+	distribution.Median = quantile(balances, 0.5)
+	distribution.P90 = quantile(balances, 0.9)
+	distribution.P99 = quantile(balances, 0.99)
+	distribution.P999 = quantile(balances, 0.999)
+	if total == 0 {
+		return distribution
+	}
+
+	distribution.Top10Share = topShare(balances, 10, total)
+	distribution.Top100Share = topShare(balances, 100, total)
+	distribution.Top1000Share = topShare(balances, 1000, total)
+
+	// Gini over the ascending ranks
+	distribution.Gini = 2*weighted/(float64(n)*total) - float64(n+1)/float64(n)
+
+	for _, balance := range balances {
+		share := float64(balance) / total
+		distribution.Herfindahl += share * share
+	}
+
+	return distribution
+}
+
+// quantile returns the nearest-rank value at q of the ascending balances
+func quantile(balances []uint64, q float64) uint64 {
+	rank := int(math.Ceil(q * float64(len(balances))))
+	if rank < 1 {
+		rank = 1
+	}
+	return balances[rank-1]
+}
+
+// topShare returns the share of total held by the top count balances
+func topShare(balances []uint64, count int, total float64) float64 {
+	var top float64
+	for index := len(balances) - 1; index >= 0 && index >= len(balances)-count; index-- {
+		top += float64(balances[index])
+	}
+	return top / total
+}
+
+// updateDistributions computes the distribution metrics of every captured
+// snapshot that doesn't have them yet
+func (i *Indexer) updateDistributions() error {
+	var snapshots []models.DropletStatsHistory
+	result := i.db.Where("height NOT IN (?)",
+		i.db.Model(&models.DropletDistributionHistory{}).Select("height"),
+	).Order("height").Find(&snapshots)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, snapshot := range snapshots {
+		balances, err := i.sortedBalances(snapshot.Height)
+		if err != nil {
+			return err
+		}
+
+		distribution := computeDistribution(balances)
+		distribution.Height = snapshot.Height
+		distribution.DateBlock = snapshot.DateBlock
+		distribution.DateCreated = time.Now()
+		result = i.db.Save(&distribution)
+		if result.Error != nil {
+			return result.Error
+		}
+
+		i.logger.WithFields(logrus.Fields{
+			"height": snapshot.Height,
+			"gini":   distribution.Gini,
+		}).Debug("Distribution updated")
+	}
+	return nil
+}
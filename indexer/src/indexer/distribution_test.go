@@ -0,0 +1,84 @@
+package indexer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestComputeDistribution(t *testing.T) {
+	tests := []struct {
+		name       string
+		balances   []uint64
+		median     uint64
+		gini       float64
+		herfindahl float64
+		top10      float64
+	}{
+		{"empty", nil, 0, 0, 0, 0},
+		{"all zero", []uint64{0, 0}, 0, 0, 0, 0},
+		{"equal", []uint64{5, 5, 5, 5}, 5, 0, 0.25, 1},
+		{"single holder", []uint64{0, 0, 0, 100}, 0, 0.75, 1, 1},
+		{"spread", []uint64{1, 2, 3, 4}, 2, 0.25, 0.3, 1},
+	}
+	for _, test := range tests {
+		distribution := computeDistribution(test.balances)
+		if distribution.Addresses != int64(len(test.balances)) {
+			t.Errorf("%s: addresses %d, want %d", test.name, distribution.Addresses, len(test.balances))
+		}
+		if distribution.Median != test.median {
+			t.Errorf("%s: median %d, want %d", test.name, distribution.Median, test.median)
+		}
+		if math.Abs(distribution.Gini-test.gini) > 1e-9 {
+			t.Errorf("%s: gini %v, want %v", test.name, distribution.Gini, test.gini)
+		}
+		if math.Abs(distribution.Herfindahl-test.herfindahl) > 1e-9 {
+			t.Errorf("%s: herfindahl %v, want %v", test.name, distribution.Herfindahl, test.herfindahl)
+		}
+		if math.Abs(distribution.Top10Share-test.top10) > 1e-9 {
+			t.Errorf("%s: top 10 share %v, want %v", test.name, distribution.Top10Share, test.top10)
+		}
+	}
+}
+
+func TestQuantile(t *testing.T) {
+	balances := []uint64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		q     float64
+		value uint64
+	}{
+		{0, 1},
+		{0.1, 1},
+		{0.5, 5},
+		{0.9, 9},
+		{0.99, 10},
+		{1, 10},
+	}
+	for _, test := range tests {
+		value := quantile(balances, test.q)
+		if value != test.value {
+			t.Errorf("quantile(%v) = %d, want %d", test.q, value, test.value)
+		}
+	}
+	if value := quantile([]uint64{7}, 0.999); value != 7 {
+		t.Errorf("quantile of a single balance = %d, want 7", value)
+	}
+}
+
+func TestTopShare(t *testing.T) {
+	balances := []uint64{1, 2, 3, 4}
+	tests := []struct {
+		count int
+		share float64
+	}{
+		{1, 0.4},
+		{2, 0.7},
+		{4, 1},
+		{10, 1},
+	}
+	for _, test := range tests {
+		share := topShare(balances, test.count, 10)
+		if math.Abs(share-test.share) > 1e-9 {
+			t.Errorf("topShare(%d) = %v, want %v", test.count, share, test.share)
+		}
+	}
+}
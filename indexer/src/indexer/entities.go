@@ -0,0 +1,281 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// EntityDefinition declares an entity and the addresses it holds
+type EntityDefinition struct {
+	Name      string   `json:"name"`
+	Addresses []string `json:"addresses"`
+}
+
+// ValidateEntityDefinition checks and normalises definition, resolving the
+// addresses to Neutron addresses and removing duplicates
+func ValidateEntityDefinition(definition *EntityDefinition) error {
+	definition.Name = strings.TrimSpace(definition.Name)
+	if definition.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	seen := make(map[string]bool)
+	addresses := make([]string, 0, len(definition.Addresses))
+	for _, address := range definition.Addresses {
+		if strings.TrimSpace(address) == "" {
+			continue
+		}
+		resolved, err := ResolveAddress(address)
+		if err != nil {
+			return fmt.Errorf("address %q: %v", address, err)
+		}
+		if seen[resolved.Address] {
+			continue
+		}
+		seen[resolved.Address] = true
+		addresses = append(addresses, resolved.Address)
+	}
+	if len(addresses) == 0 {
+		return fmt.Errorf("at least one address is required")
+	}
+	definition.Addresses = addresses
+	return nil
+}
+
+// SaveEntity creates the entity with the definition's name or replaces its
+// addresses. Positions depend on every entity, so a change of addresses
+// clears the history of all of them to be recomputed on the next pass
+func SaveEntity(db *gorm.DB, definition EntityDefinition, source string) (models.Entity, error) {
+	var entity models.Entity
+	err := db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("name = ?", definition.Name).First(&entity)
+		if result.Error == gorm.ErrRecordNotFound {
+			entity = models.Entity{
+				Name:        definition.Name,
+				Source:      source,
+				DateCreated: time.Now(),
+			}
+			result = tx.Create(&entity)
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+
+		// Leave the history alone when the addresses are unchanged, ie. the
+		// entities file is loaded again at startup
+		var current []string
+		result = tx.Model(&models.EntityAddress{}).
+			Where("entity_id = ?", entity.ID).
+			Pluck("address", &current)
+		if result.Error != nil {
+			return result.Error
+		}
+		if sameAddresses(current, definition.Addresses) {
+			return nil
+		}
+
+		result = tx.Where("entity_id = ?", entity.ID).Delete(&models.EntityAddress{})
+		if result.Error != nil {
+			return result.Error
+		}
+		members := make([]models.EntityAddress, 0, len(definition.Addresses))
+		for _, address := range definition.Addresses {
+			members = append(members, models.EntityAddress{
+				EntityID: entity.ID,
+				Address:  address,
+			})
+		}
+		result = tx.Create(&members)
+		if result.Error != nil {
+			return result.Error
+		}
+		return clearEntityHistory(tx)
+	})
+	return entity, err
+}
+
+// DeleteEntity removes an entity and its addresses, clearing the history of
+// the other entities for their positions to be recomputed without it
+func DeleteEntity(db *gorm.DB, entity models.Entity) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("entity_id = ?", entity.ID).Delete(&models.EntityAddress{})
+		if result.Error != nil {
+			return result.Error
+		}
+		err := clearEntityHistory(tx)
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&entity).Error
+	})
+}
+
+// clearEntityHistory removes the history of every entity
+func clearEntityHistory(tx *gorm.DB) error {
+	return tx.Exec("DELETE FROM entity_history").Error
+}
+
+// sameAddresses returns whether a and b hold the same addresses
+func sameAddresses(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]bool, len(a))
+	for _, address := range a {
+		set[address] = true
+	}
+	for _, address := range b {
+		if !set[address] {
+			return false
+		}
+	}
+	return true
+}
+
+// loadEntities stores the entities declared in the entities file. The file
+// is a JSON list of entity definitions
+func (i *Indexer) loadEntities() error {
+	if i.entitiesFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(i.entitiesFile)
+	if err != nil {
+		return err
+	}
+	var definitions []EntityDefinition
+	err = json.Unmarshal(data, &definitions)
+	if err != nil {
+		return fmt.Errorf("unable to parse entities file: %v", err)
+	}
+
+	for index := range definitions {
+		err = ValidateEntityDefinition(&definitions[index])
+		if err != nil {
+			return fmt.Errorf("entity %d: %v", index, err)
+		}
+		_, err = SaveEntity(i.db, definitions[index], models.EntitySourceConfig)
+		if err != nil {
+			return fmt.Errorf("entity %q: %v", definitions[index].Name, err)
+		}
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"count": len(definitions),
+	}).Info("Entities loaded")
+	return nil
+}
+
+// updateEntities computes the combined history and position of every entity
+// for the snapshots it doesn't have them for yet
+func (i *Indexer) updateEntities() error {
+	var members []models.EntityAddress
+	result := i.db.Find(&members)
+	if result.Error != nil {
+		return result.Error
+	}
+	if len(members) == 0 {
+		return nil
+	}
+	entityOf := make(map[string]uint64, len(members))
+	entityIDs := make(map[uint64]bool)
+	for _, member := range members {
+		entityOf[member.Address] = member.EntityID
+		entityIDs[member.EntityID] = true
+	}
+
+	var existing []models.EntityHistory
+	result = i.db.Select("entity_id, height").Find(&existing)
+	if result.Error != nil {
+		return result.Error
+	}
+	stored := make(map[int64]map[uint64]bool)
+	for _, history := range existing {
+		if stored[history.Height] == nil {
+			stored[history.Height] = make(map[uint64]bool)
+		}
+		stored[history.Height][history.EntityID] = true
+	}
+
+	var snapshots []models.DropletStatsHistory
+	result = i.db.Order("height").Find(&snapshots)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, snapshot := range snapshots {
+		if len(stored[snapshot.Height]) == len(entityIDs) {
+			continue
+		}
+
+		balances, err := i.balancesAtHeight(snapshot.Height)
+		if err != nil {
+			return err
+		}
+
+		// Combine the entity addresses and collect the ungrouped balances,
+		// which take part in the entity leaderboard as themselves
+		totals := make(map[uint64]uint64, len(entityIDs))
+		counts := make(map[uint64]int64, len(entityIDs))
+		var ungrouped []uint64
+		for address, droplets := range balances {
+			entityID, ok := entityOf[address]
+			if !ok {
+				ungrouped = append(ungrouped, droplets)
+				continue
+			}
+			totals[entityID] += droplets
+			counts[entityID]++
+		}
+		sort.Slice(ungrouped, func(a, b int) bool {
+			return ungrouped[a] > ungrouped[b]
+		})
+
+		var histories []models.EntityHistory
+		for entityID := range entityIDs {
+			if stored[snapshot.Height][entityID] {
+				continue
+			}
+			total := totals[entityID]
+			position := int64(1)
+			for otherID := range entityIDs {
+				if totals[otherID] > total {
+					position++
+				}
+			}
+			position += int64(sort.Search(len(ungrouped), func(index int) bool {
+				return ungrouped[index] <= total
+			}))
+
+			histories = append(histories, models.EntityHistory{
+				EntityID:    entityID,
+				Height:      snapshot.Height,
+				Droplets:    total,
+				Addresses:   counts[entityID],
+				Position:    position,
+				DateBlock:   snapshot.DateBlock,
+				DateCreated: time.Now(),
+			})
+		}
+		if len(histories) > 0 {
+			result = i.db.Create(&histories)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		i.logger.WithFields(logrus.Fields{
+			"height": snapshot.Height,
+			"count":  len(histories),
+		}).Debug("Entities updated")
+	}
+	return nil
+}
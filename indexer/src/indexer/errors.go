@@ -0,0 +1,156 @@
+package indexer
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorKind classifies a failure so a pass knows whether to retry it
+type ErrorKind int
+
+const (
+	// KindPermanent is a failure that won't go away by retrying, ie. a bad
+	// configuration, a rejected query or a constraint violation
+	KindPermanent ErrorKind = iota
+	// KindTransient is a failure of the network, the RPC or the database
+	// connection that may succeed when retried
+	KindTransient
+	// KindData is on-chain or API data that can't be parsed or doesn't make
+	// sense. Retrying won't help, the snapshot is abandoned
+	KindData
+)
+
+// String returns the name of the kind
+func (kind ErrorKind) String() string {
+	switch kind {
+	case KindTransient:
+		return "transient"
+	case KindData:
+		return "data"
+	default:
+		return "permanent"
+	}
+}
+
+// Error is a failure of an indexer operation along with its kind
+type Error struct {
+	Kind ErrorKind
+	// Op is the operation that failed, ie. "store history"
+	Op  string
+	Err error
+}
+
+// Error returns the operation and the underlying error
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// transientError wraps err from op as a transient failure
+func transientError(op string, err error) error {
+	return &Error{Kind: KindTransient, Op: op, Err: err}
+}
+
+// permanentError wraps err from op as a permanent failure
+func permanentError(op string, err error) error {
+	return &Error{Kind: KindPermanent, Op: op, Err: err}
+}
+
+// dataError wraps err from op as a data failure
+func dataError(op string, err error) error {
+	return &Error{Kind: KindData, Op: op, Err: err}
+}
+
+// KindOf returns the kind of err. Errors that weren't classified are
+// permanent
+func KindOf(err error) ErrorKind {
+	var indexerError *Error
+	if errors.As(err, &indexerError) {
+		return indexerError.Kind
+	}
+	return KindPermanent
+}
+
+// requestError classifies a failed HTTP or RPC request. Network errors and
+// timeouts are transient
+func requestError(op string, err error) error {
+	var netError net.Error
+	if errors.As(err, &netError) || errors.Is(err, context.DeadlineExceeded) {
+		return transientError(op, err)
+	}
+	return permanentError(op, err)
+}
+
+// statusError classifies a non-OK HTTP response. Rate limits and server
+// errors are transient
+func statusError(op string, response *http.Response) error {
+	err := fmt.Errorf("received non-OK HTTP status: %s", response.Status)
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= http.StatusInternalServerError {
+		return transientError(op, err)
+	}
+	return permanentError(op, err)
+}
+
+// dbError classifies a failed database operation. Lost connections,
+// serialization failures and deadlocks are transient
+func dbError(op string, err error) error {
+	var pgError *pgconn.PgError
+	if errors.As(err, &pgError) {
+		// Class 08 is a connection exception, class 57P the server shutting
+		// down
+		if strings.HasPrefix(pgError.Code, "08") || strings.HasPrefix(pgError.Code, "57P") ||
+			pgError.Code == "40001" || pgError.Code == "40P01" {
+			return transientError(op, err)
+		}
+		return permanentError(op, err)
+	}
+	if errors.Is(err, driver.ErrBadConn) || pgconn.SafeToRetry(err) || pgconn.Timeout(err) {
+		return transientError(op, err)
+	}
+	var netError net.Error
+	if errors.As(err, &netError) {
+		return transientError(op, err)
+	}
+	return permanentError(op, err)
+}
+
+// retry calls call until it succeeds, fails with an error that isn't
+// transient or the configured attempts are used up, doubling the wait
+// between attempts
+func (i *Indexer) retry(ctx context.Context, op string, call func() error) error {
+	backoff := i.retryBackoff
+	for attempt := 1; ; attempt++ {
+		err := call()
+		if err == nil || KindOf(err) != KindTransient || attempt >= i.retryAttempts {
+			return err
+		}
+
+		retries.WithLabelValues(op).Inc()
+		i.logger.WithFields(logrus.Fields{
+			"op":      op,
+			"attempt": attempt,
+			"backoff": backoff,
+			"err":     err,
+		}).Warning("Retrying")
+
+		select {
+		case <-ctx.Done():
+			return transientError(op, ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
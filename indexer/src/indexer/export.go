@@ -0,0 +1,589 @@
+package indexer
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"gorm.io/gorm"
+)
+
+// Datasets that can be exported
+const (
+	// ExportLeaderboard is the current leaderboard, or the ranking of the
+	// snapshot at a height
+	ExportLeaderboard = "leaderboard"
+	// ExportHistory is the balance of every address in every snapshot
+	ExportHistory = "history"
+	// ExportStats is the totals of every snapshot
+	ExportStats = "stats"
+	// ExportDropAtom is the Drop staked ATOM total of every snapshot
+	ExportDropAtom = "datom"
+)
+
+// ExportDatasets are the datasets in the order they are exported
+var ExportDatasets = []string{ExportLeaderboard, ExportHistory, ExportStats, ExportDropAtom}
+
+// Formats a dataset can be exported in
+const (
+	// FormatNDJSON is newline delimited JSON, an object per row
+	FormatNDJSON = "ndjson"
+	// FormatCSV is CSV with a header row
+	FormatCSV = "csv"
+	// FormatParquet is a Parquet file, snappy compressed
+	FormatParquet = "parquet"
+)
+
+// exportContentTypes are the media types of the export formats
+var exportContentTypes = map[string]string{
+	FormatNDJSON:  "application/x-ndjson",
+	FormatCSV:     "text/csv",
+	FormatParquet: "application/vnd.apache.parquet",
+}
+
+// parquetRowGroupSize is the number of rows buffered before a Parquet row
+// group is written, bounding the memory an export needs
+const parquetRowGroupSize = 50000
+
+// Types of the exported columns
+const (
+	columnInt = iota
+	columnString
+	columnBool
+	columnTime
+)
+
+// exportColumn is a column of an exported dataset
+type exportColumn struct {
+	name string
+	kind int
+}
+
+// exportDataset is the query of a dataset, filtered and ordered so exports
+// are stable
+type exportDataset struct {
+	columns []exportColumn
+	// from is the FROM clause, it may select from a subquery
+	from    string
+	orderBy string
+}
+
+// exportDatasets are the queries of the datasets
+var exportDatasets = map[string]exportDataset{
+	ExportLeaderboard: {
+		columns: []exportColumn{
+			{"position", columnInt}, {"address", columnString}, {"droplets", columnInt},
+			{"height", columnInt}, {"date_block", columnTime},
+		},
+		from:    "droplet_leaderboard",
+		orderBy: "position",
+	},
+	ExportHistory: {
+		columns: []exportColumn{
+			{"height", columnInt}, {"address", columnString}, {"droplets", columnInt},
+			{"excluded", columnBool}, {"date_block", columnTime},
+		},
+		from:    "droplet_address_history",
+		orderBy: "height, address",
+	},
+	ExportStats: {
+		columns: []exportColumn{
+			{"height", columnInt}, {"total_droplets", columnInt}, {"total_addresses", columnInt},
+			{"total_droplets_all", columnInt}, {"total_addresses_all", columnInt},
+			{"verification_status", columnString}, {"date_block", columnTime},
+		},
+		from:    "droplet_stats_history",
+		orderBy: "height",
+	},
+	ExportDropAtom: {
+		columns: []exportColumn{
+			{"height", columnInt}, {"total_atom", columnInt}, {"date_block", columnTime},
+		},
+		from:    "drop_atom_history",
+		orderBy: "height",
+	},
+}
+
+// leaderboardAtHeight ranks the addresses in the snapshot at a height the way
+// the leaderboard is ranked
+const leaderboardAtHeight = `(SELECT ROW_NUMBER() OVER (ORDER BY droplets DESC) AS position,
+		address, droplets, height, date_block
+	FROM droplet_address_history WHERE height = ? AND excluded = false) AS ranked`
+
+// ExportFilter limits the rows exported. Zero values don't filter
+type ExportFilter struct {
+	// FromHeight and ToHeight are an inclusive height range, the leaderboard
+	// takes a single height, setting both to it
+	FromHeight int64 `json:"from_height,omitempty"`
+	ToHeight   int64 `json:"to_height,omitempty"`
+	// Since and Until are a block date range, Since inclusive and Until
+	// exclusive
+	Since time.Time `json:"since,omitempty"`
+	Until time.Time `json:"until,omitempty"`
+	// Address limits the history to a single address
+	Address string `json:"address,omitempty"`
+}
+
+// ExportFile is an exported dataset with the checksum of what was written
+type ExportFile struct {
+	Dataset string `json:"dataset"`
+	Format  string `json:"format"`
+	// File is the name the dataset was written to, if any
+	File   string `json:"file,omitempty"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+// ExportManifest lists the files of an export with their row counts and
+// checksums
+type ExportManifest struct {
+	DateCreated time.Time    `json:"date_created"`
+	Filter      ExportFilter `json:"filter"`
+	Files       []ExportFile `json:"files"`
+}
+
+// ExportExtension returns the file extension of format
+func ExportExtension(format string) string {
+	return "." + format
+}
+
+// ExportContentType returns the media type of format
+func ExportContentType(format string) string {
+	return exportContentTypes[format]
+}
+
+// ParseExportDate parses a date given as either YYYY-MM-DD or RFC3339. A day
+// given as the end of a range includes the whole day
+func ParseExportDate(value string, end bool) (time.Time, error) {
+	date, err := time.Parse("2006-01-02", value)
+	if err == nil {
+		if end {
+			date = date.AddDate(0, 0, 1)
+		}
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ValidateExport checks a dataset, format and filter can be exported together
+func ValidateExport(dataset string, format string, filter ExportFilter) error {
+	if _, ok := exportDatasets[dataset]; !ok {
+		return fmt.Errorf("unknown dataset %q, use %s", dataset, strings.Join(ExportDatasets, ", "))
+	}
+	if _, ok := exportContentTypes[format]; !ok {
+		return fmt.Errorf("unknown format %q, use %s, %s or %s", format, FormatNDJSON, FormatCSV, FormatParquet)
+	}
+	if filter.FromHeight < 0 || filter.ToHeight < 0 {
+		return errors.New("heights must be positive")
+	}
+	if filter.ToHeight > 0 && filter.ToHeight < filter.FromHeight {
+		return errors.New("the height range ends before it starts")
+	}
+	if !filter.Until.IsZero() && !filter.Until.After(filter.Since) {
+		return errors.New("the date range ends before it starts")
+	}
+	if filter.Address != "" && dataset != ExportHistory {
+		return fmt.Errorf("only the %s dataset filters by address", ExportHistory)
+	}
+	if dataset == ExportLeaderboard {
+		if filter.FromHeight != filter.ToHeight || !filter.Since.IsZero() || !filter.Until.IsZero() {
+			return fmt.Errorf("the %s dataset takes a single height", ExportLeaderboard)
+		}
+	}
+	return nil
+}
+
+// Export writes the rows of dataset to w in format, streaming them from the
+// database, and returns the rows and bytes written with their checksum
+func (i *Indexer) Export(ctx context.Context, w io.Writer, dataset string, format string, filter ExportFilter) (ExportFile, error) {
+	return WriteExport(ctx, i.db, w, dataset, format, filter)
+}
+
+// ExportFiles writes datasets in format to the writers create returns for
+// their file names, from the same snapshot of the database, and returns the
+// manifest of the files
+func (i *Indexer) ExportFiles(
+	ctx context.Context,
+	datasets []string,
+	format string,
+	filter ExportFilter,
+	create func(name string) (io.WriteCloser, error)) (ExportManifest, error) {
+	return ExportFiles(ctx, i.db, datasets, format, filter, create)
+}
+
+// WriteExport writes the rows of dataset in db to w in format, streaming them
+// from the database, and returns the rows and bytes written with their
+// checksum. Rows are ordered so the same data exports to the same bytes
+func WriteExport(ctx context.Context, db *gorm.DB, w io.Writer, dataset string, format string, filter ExportFilter) (ExportFile, error) {
+	file := ExportFile{
+		Dataset: dataset,
+		Format:  format,
+	}
+	err := ValidateExport(dataset, format, filter)
+	if err != nil {
+		return file, permanentError("export", err)
+	}
+	op := "export " + dataset
+
+	query, args := exportQuery(dataset, filter)
+	rows, err := db.WithContext(ctx).Raw(query, args...).Rows()
+	if err != nil {
+		return file, dbError(op, err)
+	}
+	defer rows.Close()
+
+	checksum := &checksumWriter{writer: w, hash: sha256.New()}
+	encoder := newExportEncoder(checksum, format, exportDatasets[dataset].columns)
+
+	columns := exportDatasets[dataset].columns
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for n := range values {
+		pointers[n] = &values[n]
+	}
+	for rows.Next() {
+		err = rows.Scan(pointers...)
+		if err != nil {
+			return file, dbError(op, err)
+		}
+		err = encoder.write(values)
+		if err != nil {
+			return file, permanentError(op, err)
+		}
+		file.Rows++
+	}
+	err = rows.Err()
+	if err != nil {
+		return file, dbError(op, err)
+	}
+	err = encoder.close()
+	if err != nil {
+		return file, permanentError(op, err)
+	}
+
+	file.Bytes = checksum.bytes
+	file.SHA256 = hex.EncodeToString(checksum.hash.Sum(nil))
+	return file, nil
+}
+
+// ExportFiles writes datasets in format to the writers create returns for
+// their file names, in a single read-only REPEATABLE READ transaction so the
+// files and their manifest describe the same data even when a snapshot is
+// stored meanwhile
+func ExportFiles(
+	ctx context.Context,
+	db *gorm.DB,
+	datasets []string,
+	format string,
+	filter ExportFilter,
+	create func(name string) (io.WriteCloser, error)) (ExportManifest, error) {
+
+	manifest := ExportManifest{
+		DateCreated: time.Now().UTC(),
+		Filter:      filter,
+		Files:       []ExportFile{},
+	}
+	for _, dataset := range datasets {
+		err := ValidateExport(dataset, format, filter)
+		if err != nil {
+			return manifest, permanentError("export", err)
+		}
+	}
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, dataset := range datasets {
+			name := dataset + ExportExtension(format)
+			output, err := create(name)
+			if err != nil {
+				return permanentError("export "+dataset, err)
+			}
+			file, err := WriteExport(ctx, tx, output, dataset, format, filter)
+			closeErr := output.Close()
+			if err != nil {
+				return err
+			}
+			if closeErr != nil {
+				return permanentError("export "+dataset, closeErr)
+			}
+			file.File = name
+			manifest.Files = append(manifest.Files, file)
+		}
+		return nil
+	}, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	return manifest, err
+}
+
+// exportQuery returns the query of dataset limited by filter
+func exportQuery(dataset string, filter ExportFilter) (string, []any) {
+	definition := exportDatasets[dataset]
+	names := make([]string, len(definition.columns))
+	for n, column := range definition.columns {
+		names[n] = column.name
+	}
+
+	from := definition.from
+	var args []any
+	var conditions []string
+	if dataset == ExportLeaderboard {
+		// The leaderboard table only holds the latest snapshot
+		if filter.FromHeight > 0 {
+			from = leaderboardAtHeight
+			args = append(args, filter.FromHeight)
+		}
+	} else {
+		if filter.FromHeight > 0 {
+			conditions = append(conditions, "height >= ?")
+			args = append(args, filter.FromHeight)
+		}
+		if filter.ToHeight > 0 {
+			conditions = append(conditions, "height <= ?")
+			args = append(args, filter.ToHeight)
+		}
+		if !filter.Since.IsZero() {
+			conditions = append(conditions, "date_block >= ?")
+			args = append(args, filter.Since)
+		}
+		if !filter.Until.IsZero() {
+			conditions = append(conditions, "date_block < ?")
+			args = append(args, filter.Until)
+		}
+		if filter.Address != "" {
+			conditions = append(conditions, "address = ?")
+			args = append(args, filter.Address)
+		}
+	}
+
+	query := "SELECT " + strings.Join(names, ", ") + " FROM " + from
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return query + " ORDER BY " + definition.orderBy, args
+}
+
+// checksumWriter hashes and counts the bytes written through it
+type checksumWriter struct {
+	writer io.Writer
+	hash   hash.Hash
+	bytes  int64
+}
+
+func (c *checksumWriter) Write(p []byte) (int, error) {
+	n, err := c.writer.Write(p)
+	c.hash.Write(p[:n])
+	c.bytes += int64(n)
+	return n, err
+}
+
+// exportEncoder writes the rows of a dataset in a format
+type exportEncoder interface {
+	write(values []any) error
+	close() error
+}
+
+// newExportEncoder returns the encoder of format writing to w
+func newExportEncoder(w io.Writer, format string, columns []exportColumn) exportEncoder {
+	switch format {
+	case FormatCSV:
+		return newCSVEncoder(w, columns)
+	case FormatParquet:
+		return newParquetEncoder(w, columns)
+	default:
+		return &ndjsonEncoder{writer: bufio.NewWriter(w), columns: columns}
+	}
+}
+
+// ndjsonEncoder writes a JSON object per row, its keys in the order of the
+// columns
+type ndjsonEncoder struct {
+	writer  *bufio.Writer
+	columns []exportColumn
+}
+
+func (e *ndjsonEncoder) write(values []any) error {
+	e.writer.WriteByte('{')
+	for n, column := range e.columns {
+		if n > 0 {
+			e.writer.WriteByte(',')
+		}
+		value, err := json.Marshal(values[n])
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.writer, "%q:%s", column.name, value)
+	}
+	_, err := e.writer.WriteString("}\n")
+	return err
+}
+
+func (e *ndjsonEncoder) close() error {
+	return e.writer.Flush()
+}
+
+// csvEncoder writes a header row followed by a row per record. Dates are
+// RFC3339 in UTC
+type csvEncoder struct {
+	writer  *csv.Writer
+	columns []exportColumn
+	header  bool
+	record  []string
+}
+
+func newCSVEncoder(w io.Writer, columns []exportColumn) *csvEncoder {
+	return &csvEncoder{
+		writer:  csv.NewWriter(w),
+		columns: columns,
+		record:  make([]string, len(columns)),
+	}
+}
+
+func (e *csvEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	for n, column := range e.columns {
+		e.record[n] = column.name
+	}
+	return e.writer.Write(e.record)
+}
+
+func (e *csvEncoder) write(values []any) error {
+	err := e.writeHeader()
+	if err != nil {
+		return err
+	}
+	for n, value := range values {
+		switch value := value.(type) {
+		case nil:
+			e.record[n] = ""
+		case time.Time:
+			e.record[n] = value.UTC().Format(time.RFC3339)
+		case []byte:
+			e.record[n] = string(value)
+		default:
+			e.record[n] = fmt.Sprint(value)
+		}
+	}
+	return e.writer.Write(e.record)
+}
+
+func (e *csvEncoder) close() error {
+	// An empty export still has its header
+	err := e.writeHeader()
+	if err != nil {
+		return err
+	}
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// parquetEncoder writes the rows as a Parquet file. Every column is optional
+// so NULLs survive the export
+type parquetEncoder struct {
+	writer  *parquet.Writer
+	columns []exportColumn
+	// indexes are the leaf column indexes of the columns, the schema orders
+	// them by name
+	indexes []int
+	rows    []parquet.Row
+}
+
+func newParquetEncoder(w io.Writer, columns []exportColumn) *parquetEncoder {
+	group := parquet.Group{}
+	for _, column := range columns {
+		var node parquet.Node
+		switch column.kind {
+		case columnString:
+			node = parquet.String()
+		case columnBool:
+			node = parquet.Leaf(parquet.BooleanType)
+		case columnTime:
+			node = parquet.Timestamp(parquet.Millisecond)
+		default:
+			node = parquet.Int(64)
+		}
+		group[column.name] = parquet.Optional(node)
+	}
+	schema := parquet.NewSchema("export", group)
+
+	indexes := make([]int, len(columns))
+	for index, field := range schema.Fields() {
+		for n, column := range columns {
+			if column.name == field.Name() {
+				indexes[n] = index
+			}
+		}
+	}
+
+	return &parquetEncoder{
+		writer: parquet.NewWriter(w, schema,
+			parquet.Compression(&parquet.Snappy),
+			parquet.MaxRowsPerRowGroup(parquetRowGroupSize),
+		),
+		columns: columns,
+		indexes: indexes,
+		rows:    make([]parquet.Row, 0, 1024),
+	}
+}
+
+func (e *parquetEncoder) write(values []any) error {
+	row := make(parquet.Row, len(e.columns))
+	for n, value := range values {
+		var cell parquet.Value
+		switch value := value.(type) {
+		case nil:
+			row[e.indexes[n]] = parquet.Value{}.Level(0, 0, e.indexes[n])
+			continue
+		case time.Time:
+			cell = parquet.Int64Value(value.UnixMilli())
+		case bool:
+			cell = parquet.BooleanValue(value)
+		case string:
+			cell = parquet.ByteArrayValue([]byte(value))
+		case []byte:
+			cell = parquet.ByteArrayValue(value)
+		case int64:
+			cell = parquet.Int64Value(value)
+		default:
+			parsed, err := strconv.ParseInt(fmt.Sprint(value), 10, 64)
+			if err != nil {
+				return fmt.Errorf("unsupported value %v of column %s", value, e.columns[n].name)
+			}
+			cell = parquet.Int64Value(parsed)
+		}
+		row[e.indexes[n]] = cell.Level(0, 1, e.indexes[n])
+	}
+	e.rows = append(e.rows, row)
+	if len(e.rows) == cap(e.rows) {
+		return e.flush()
+	}
+	return nil
+}
+
+// flush hands the buffered rows to the writer
+func (e *parquetEncoder) flush() error {
+	_, err := e.writer.WriteRows(e.rows)
+	e.rows = e.rows[:0]
+	return err
+}
+
+func (e *parquetEncoder) close() error {
+	err := e.flush()
+	if err != nil {
+		return err
+	}
+	return e.writer.Close()
+}
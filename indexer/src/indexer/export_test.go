@@ -0,0 +1,109 @@
+package indexer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExportQuery(t *testing.T) {
+	since := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		dataset string
+		filter  ExportFilter
+		query   string
+		args    []any
+	}{
+		{"leaderboard", ExportLeaderboard, ExportFilter{},
+			"droplet_leaderboard ORDER BY position", nil},
+		{"leaderboard at height", ExportLeaderboard, ExportFilter{FromHeight: 10, ToHeight: 10},
+			leaderboardAtHeight + " ORDER BY position", []any{int64(10)}},
+		{"history", ExportHistory, ExportFilter{},
+			"droplet_address_history ORDER BY height, address", nil},
+		{"history of an address", ExportHistory, ExportFilter{Address: "neutron1abc"},
+			"droplet_address_history WHERE address = ? ORDER BY height, address", []any{"neutron1abc"}},
+		{"stats from height", ExportStats, ExportFilter{FromHeight: 10},
+			"droplet_stats_history WHERE height >= ? ORDER BY height", []any{int64(10)}},
+		{"stats in a height range", ExportStats, ExportFilter{FromHeight: 10, ToHeight: 20},
+			"droplet_stats_history WHERE height >= ? AND height <= ? ORDER BY height", []any{int64(10), int64(20)}},
+		{"dATOM in a date range", ExportDropAtom, ExportFilter{Since: since, Until: until},
+			"drop_atom_history WHERE date_block >= ? AND date_block < ? ORDER BY height", []any{since, until}},
+		{"history with every filter", ExportHistory,
+			ExportFilter{FromHeight: 10, ToHeight: 20, Since: since, Until: until, Address: "neutron1abc"},
+			"droplet_address_history WHERE height >= ? AND height <= ? AND date_block >= ? AND date_block < ? " +
+				"AND address = ? ORDER BY height, address",
+			[]any{int64(10), int64(20), since, until, "neutron1abc"}},
+	}
+	for _, test := range tests {
+		query, args := exportQuery(test.dataset, test.filter)
+		if !strings.HasPrefix(query, "SELECT ") {
+			t.Errorf("%s: query %q doesn't select", test.name, query)
+			continue
+		}
+		_, from, _ := strings.Cut(query, " FROM ")
+		if from != test.query {
+			t.Errorf("%s: query from %q, want %q", test.name, from, test.query)
+		}
+		if !reflect.DeepEqual(args, test.args) {
+			t.Errorf("%s: args %v, want %v", test.name, args, test.args)
+		}
+	}
+}
+
+func TestValidateExport(t *testing.T) {
+	since := time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		dataset string
+		format  string
+		filter  ExportFilter
+		ok      bool
+	}{
+		{"every dataset", ExportStats, FormatNDJSON, ExportFilter{}, true},
+		{"csv", ExportHistory, FormatCSV, ExportFilter{}, true},
+		{"parquet", ExportDropAtom, FormatParquet, ExportFilter{}, true},
+		{"unknown dataset", "balances", FormatNDJSON, ExportFilter{}, false},
+		{"unknown format", ExportStats, "xml", ExportFilter{}, false},
+		{"negative height", ExportStats, FormatNDJSON, ExportFilter{FromHeight: -1}, false},
+		{"height range", ExportStats, FormatNDJSON, ExportFilter{FromHeight: 10, ToHeight: 20}, true},
+		{"open height range", ExportStats, FormatNDJSON, ExportFilter{FromHeight: 10}, true},
+		{"reversed height range", ExportStats, FormatNDJSON, ExportFilter{FromHeight: 20, ToHeight: 10}, false},
+		{"date range", ExportStats, FormatNDJSON, ExportFilter{Since: since, Until: since.AddDate(0, 0, 1)}, true},
+		{"empty date range", ExportStats, FormatNDJSON, ExportFilter{Since: since, Until: since}, false},
+		{"history address", ExportHistory, FormatNDJSON, ExportFilter{Address: "neutron1abc"}, true},
+		{"stats address", ExportStats, FormatNDJSON, ExportFilter{Address: "neutron1abc"}, false},
+		{"latest leaderboard", ExportLeaderboard, FormatCSV, ExportFilter{}, true},
+		{"leaderboard at height", ExportLeaderboard, FormatCSV, ExportFilter{FromHeight: 10, ToHeight: 10}, true},
+		{"leaderboard range", ExportLeaderboard, FormatCSV, ExportFilter{FromHeight: 10, ToHeight: 20}, false},
+		{"leaderboard dates", ExportLeaderboard, FormatCSV, ExportFilter{Since: since}, false},
+	}
+	for _, test := range tests {
+		err := ValidateExport(test.dataset, test.format, test.filter)
+		if (err == nil) != test.ok {
+			t.Errorf("%s: ValidateExport() = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestParseExportDate(t *testing.T) {
+	tests := []struct {
+		value string
+		end   bool
+		date  time.Time
+		ok    bool
+	}{
+		{"2024-11-01", false, time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC), true},
+		{"2024-11-01", true, time.Date(2024, 11, 2, 0, 0, 0, 0, time.UTC), true},
+		{"2024-11-01T12:30:00Z", true, time.Date(2024, 11, 1, 12, 30, 0, 0, time.UTC), true},
+		{"01/11/2024", false, time.Time{}, false},
+	}
+	for _, test := range tests {
+		date, err := ParseExportDate(test.value, test.end)
+		if (err == nil) != test.ok || (test.ok && !date.Equal(test.date)) {
+			t.Errorf("ParseExportDate(%q, %v) = %v, %v, want %v, ok %v", test.value, test.end, date, err, test.date, test.ok)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	rpchttp "github.com/tendermint/tendermint/rpc/client/http"
+)
+
+// healthState is what the indexer last saw of the chain, kept for the health
+// checks
+type healthState struct {
+	mutex sync.Mutex
+	// started is when the indexer was created
+	started time.Time
+	// lastCheck is when an on-chain update was last detected successfully
+	lastCheck time.Time
+	// detectedHeight and detectedTime are the last on-chain update
+	detectedHeight int64
+	detectedTime   time.Time
+	// capturedHeight is the height of the last captured snapshot
+	capturedHeight int64
+	// held is set when the detected update is quarantined, waiting for
+	// approval
+	held bool
+}
+
+// observeUpdate records the on-chain update detected by a pass along with
+// the last captured height
+func (i *Indexer) observeUpdate(height int64, updateTime time.Time, capturedHeight int64, held bool) {
+	i.health.mutex.Lock()
+	defer i.health.mutex.Unlock()
+	i.health.lastCheck = time.Now()
+	i.health.detectedHeight = height
+	i.health.detectedTime = updateTime
+	i.health.capturedHeight = capturedHeight
+	i.health.held = held
+}
+
+// observeCapture records a captured snapshot
+func (i *Indexer) observeCapture(height int64) {
+	i.health.mutex.Lock()
+	defer i.health.mutex.Unlock()
+	i.health.capturedHeight = height
+}
+
+// observeHeld records that the detected update was quarantined
+func (i *Indexer) observeHeld() {
+	i.health.mutex.Lock()
+	defer i.health.mutex.Unlock()
+	i.health.held = true
+}
+
+// Healthy returns an error if the indexer is stuck: it hasn't detected
+// on-chain updates, or hasn't captured the last one detected, within the
+// configured staleness. A quarantined update waits for a review, which a
+// restart won't fix, so it doesn't count as stuck
+func (i *Indexer) Healthy(ctx context.Context) error {
+	i.health.mutex.Lock()
+	defer i.health.mutex.Unlock()
+
+	now := time.Now()
+	if i.health.lastCheck.IsZero() {
+		if now.Sub(i.health.started) > i.maxStaleness {
+			return fmt.Errorf("no on-chain update detected since starting %s ago",
+				now.Sub(i.health.started).Round(time.Second))
+		}
+		return nil
+	}
+	if now.Sub(i.health.lastCheck) > i.maxStaleness {
+		return fmt.Errorf("last on-chain update detected %s ago",
+			now.Sub(i.health.lastCheck).Round(time.Second))
+	}
+	if i.health.capturedHeight < i.health.detectedHeight && !i.health.held &&
+		now.Sub(i.health.detectedTime) > i.maxStaleness {
+		return fmt.Errorf("on-chain update at height %d from %s not captured, last captured height is %d",
+			i.health.detectedHeight, i.health.detectedTime.Format(time.RFC3339), i.health.capturedHeight)
+	}
+	return nil
+}
+
+// Ready returns an error if the database or the RPC can't be reached
+func (i *Indexer) Ready(ctx context.Context) error {
+	db, err := i.db.DB()
+	if err != nil {
+		return err
+	}
+	err = db.PingContext(ctx)
+	if err != nil {
+		return fmt.Errorf("database unreachable: %v", err)
+	}
+
+	client, err := rpchttp.New(i.rpcEndpoint)
+	if err != nil {
+		return err
+	}
+	_, err = client.Status(ctx)
+	if err != nil {
+		return fmt.Errorf("RPC unreachable: %v", err)
+	}
+	return nil
+}
@@ -2,12 +2,13 @@ package indexer
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
@@ -17,18 +18,43 @@ import (
 	"github.com/tendermint/tendermint/libs/bytes"
 	rpcclient "github.com/tendermint/tendermint/rpc/client"
 	rpchttp "github.com/tendermint/tendermint/rpc/client/http"
+	"go.opentelemetry.io/otel/attribute"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
 type Config struct {
-	DatabaseDSN             string   `envconfig:"DATABASE_DSN" required:"true"`
-	RPCEndpoint             string   `envconfig:"RPC_ENDPOINT" required:"true"`
-	CelatoneQuery           string   `envconfig:"CELATONE_QUERY" required:"true"`
-	DropAtomQuery           string   `envconfig:"DROP_ATOM_QUERY" required:"true"`
-	DropletsContractAddress string   `envconfig:"DROPLETS_CONTRACT_ADDRESS" required:"true"`
-	Skiplist                []string `envconfig:"SKIPLIST" required:"true"`
+	DatabaseDSN             string   `envconfig:"DATABASE_DSN" required:"true" validate:"dsn" secret:"true"`
+	RPCEndpoint             string   `envconfig:"RPC_ENDPOINT" required:"true" validate:"url"`
+	CelatoneQuery           string   `envconfig:"CELATONE_QUERY" required:"true" validate:"url"`
+	LCDEndpoint             string   `envconfig:"LCD_ENDPOINT" required:"false" validate:"url"`
+	QueryTransport          string   `envconfig:"QUERY_TRANSPORT" default:"rpc"`
+	DropCoreContractAddress string   `envconfig:"DROP_CORE_CONTRACT_ADDRESS" required:"false" validate:"contract"`
+	DropAtomQuery           string   `envconfig:"DROP_ATOM_QUERY" default:"{\"total_bonded\":{}}" validate:"query"`
+	DropAtomPath            string   `envconfig:"DROP_ATOM_PATH" default:"$"`
+	DropletsContractAddress string   `envconfig:"DROPLETS_CONTRACT_ADDRESS" required:"true" validate:"contract"`
+	Skiplist                []string `envconfig:"SKIPLIST" required:"false"`
+	LabelsFile              string   `envconfig:"LABELS_FILE" required:"false"`
+	EntitiesFile            string   `envconfig:"ENTITIES_FILE" required:"false"`
+
+	PositionRateChangeThreshold float64 `envconfig:"POSITION_RATE_CHANGE_THRESHOLD" default:"2"`
+	DormantUpdates              int     `envconfig:"DORMANT_UPDATES" default:"3"`
+
+	AnomalyMaxAddressDrop     float64 `envconfig:"ANOMALY_MAX_ADDRESS_DROP" default:"0.01"`
+	AnomalyMaxFallingBalances int     `envconfig:"ANOMALY_MAX_FALLING_BALANCES" default:"0"`
+	AnomalyGrowthRangeFactor  float64 `envconfig:"ANOMALY_GROWTH_RANGE_FACTOR" default:"3"`
+	AnomalyMaxDropAtomChange  float64 `envconfig:"ANOMALY_MAX_DATOM_CHANGE" default:"0.2"`
+
+	HealthMaxStaleness time.Duration `envconfig:"HEALTH_MAX_STALENESS" default:"2h"`
+	PassInterval       time.Duration `envconfig:"PASS_INTERVAL" default:"30m"`
+
+	StateArchive    string `envconfig:"STATE_ARCHIVE" required:"false"`
+	StateArchiveDir string `envconfig:"STATE_ARCHIVE_DIR" default:"archive"`
+
+	RetryAttempts    int           `envconfig:"RETRY_ATTEMPTS" default:"3"`
+	RetryBackoff     time.Duration `envconfig:"RETRY_BACKOFF" default:"2s"`
+	MaxWriteFailures int           `envconfig:"MAX_WRITE_FAILURES" default:"0"`
 
 	TempHistoryHeight uint64 `envconfig:"TEMP_HISTORY_HEIGHT" required:"false"`
 	TempHistoryDate   string `envconfig:"TEMP_HISTORY_DATE" required:"false"`
@@ -38,20 +64,46 @@ type Config struct {
 type Indexer struct {
 	rpcEndpoint             string
 	celatoneQuery           string
-	dropAtomQuery           string
+	lcdEndpoint             string
+	queryTransport          string
+	dropAtomQuery           SmartQuery
 	dropletsContractAddress string
 	logger                  *logrus.Entry
-	stopChannel             chan bool
+	cancel                  context.CancelFunc
+	cancelMutex             sync.Mutex
 	db                      *gorm.DB
 	lastTransationTime      time.Time
 	skipList                []string
+	labelsFile              string
+	entitiesFile            string
+	checkedContracts        map[string]bool
+
+	positionRateChangeThreshold float64
+	dormantUpdates              int
+
+	anomalyMaxAddressDrop     float64
+	anomalyMaxFallingBalances int
+	anomalyGrowthRangeFactor  float64
+	anomalyMaxDropAtomChange  float64
+
+	health       healthState
+	maxStaleness time.Duration
+	passInterval time.Duration
+
+	stateArchive    string
+	stateArchiveDir string
+
+	retryAttempts    int
+	retryBackoff     time.Duration
+	maxWriteFailures int
 
 	tempHistoryHeight uint64
 	tempHistoryDate   time.Time
 }
 
-// New returns a new instance of the indexer service and returns an error if
-// there was a problem setting up the service
+// New returns a new instance of the indexer service, migrating the schema,
+// and returns an error if there was a problem setting up the service. The
+// commands that only read use NewReader
 func New(
 	log *logrus.Entry) (*Indexer, error) {
 
@@ -59,8 +111,45 @@ func New(
 	var config Config
 	err := envconfig.Process("", &config)
 	if err != nil {
-		log.Fatalf("Unable to process config: %s", err)
+		return nil, fmt.Errorf("unable to process config: %v", err)
+	}
+	switch strings.ToLower(config.QueryTransport) {
+	case TransportRPC:
+	case TransportLCD:
+		if config.LCDEndpoint == "" {
+			return nil, fmt.Errorf("LCD_ENDPOINT is required for the %s query transport", TransportLCD)
+		}
+	default:
+		return nil, fmt.Errorf("unknown query transport %q, use %s or %s",
+			config.QueryTransport, TransportRPC, TransportLCD)
+	}
+	switch strings.ToLower(config.StateArchive) {
+	case ArchiveNone, ArchiveDisk, ArchiveDB:
+	default:
+		return nil, fmt.Errorf("unknown state archive %q, use %s or %s",
+			config.StateArchive, ArchiveDisk, ArchiveDB)
+	}
+	// The threshold is a ratio, at 1 or below every position is flagged
+	if config.PositionRateChangeThreshold <= 1 {
+		return nil, fmt.Errorf("POSITION_RATE_CHANGE_THRESHOLD must be greater than 1, got %v",
+			config.PositionRateChangeThreshold)
+	}
+	_, err = parsePath(config.DropAtomPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DROP_ATOM_PATH: %v", err)
+	}
+	dropAtomQuery, legacy, err := parseDropAtomQuery(config.DropCoreContractAddress, config.DropAtomQuery)
+	if err != nil {
+		return nil, err
+	}
+	if legacy {
+		log.WithFields(logrus.Fields{
+			"contract": dropAtomQuery.Contract,
+			"message":  dropAtomQuery.Message,
+		}).Warn("DROP_ATOM_QUERY is a legacy REST URL, its contract and message are used over " +
+			"QUERY_TRANSPORT. Set DROP_CORE_CONTRACT_ADDRESS and DROP_ATOM_QUERY to the message instead")
 	}
+	dropAtomQuery.Path = config.DropAtomPath
 
 	db, err := gorm.Open(postgres.Open(config.DatabaseDSN), &gorm.Config{
 		Logger: logger.Default.LogMode(logger.Silent),
@@ -68,6 +157,15 @@ func New(
 	if err != nil {
 		return nil, err
 	}
+	err = registerDBMetrics(db)
+	if err != nil {
+		return nil, err
+	}
+
+	err = Migrate(db)
+	if err != nil {
+		return nil, err
+	}
 
 	// TEMP
 	// historyDate, err := time.Parse("2006-01-02T15:04:05", config.TempHistoryDate)
@@ -76,26 +174,248 @@ func New(
 	// }
 	historyDate := time.Now()
 
-	return &Indexer{
+	indexer := &Indexer{
 		rpcEndpoint:             config.RPCEndpoint,
 		celatoneQuery:           config.CelatoneQuery,
-		dropAtomQuery:           config.DropAtomQuery,
+		lcdEndpoint:             config.LCDEndpoint,
+		queryTransport:          strings.ToLower(config.QueryTransport),
+		dropAtomQuery:           dropAtomQuery,
 		dropletsContractAddress: config.DropletsContractAddress,
 		logger:                  log,
-		stopChannel:             make(chan bool),
 		db:                      db,
 		lastTransationTime:      time.Now(),
 		skipList:                config.Skiplist,
+		labelsFile:              config.LabelsFile,
+		entitiesFile:            config.EntitiesFile,
+		checkedContracts:        make(map[string]bool),
+
+		positionRateChangeThreshold: config.PositionRateChangeThreshold,
+		dormantUpdates:              config.DormantUpdates,
+
+		anomalyMaxAddressDrop:     config.AnomalyMaxAddressDrop,
+		anomalyMaxFallingBalances: config.AnomalyMaxFallingBalances,
+		anomalyGrowthRangeFactor:  config.AnomalyGrowthRangeFactor,
+		anomalyMaxDropAtomChange:  config.AnomalyMaxDropAtomChange,
+
+		health: healthState{
+			started: time.Now(),
+		},
+		maxStaleness: config.HealthMaxStaleness,
+		passInterval: config.PassInterval,
+
+		stateArchive:    strings.ToLower(config.StateArchive),
+		stateArchiveDir: config.StateArchiveDir,
+
+		retryAttempts:    config.RetryAttempts,
+		retryBackoff:     config.RetryBackoff,
+		maxWriteFailures: config.MaxWriteFailures,
 
 		tempHistoryHeight: config.TempHistoryHeight,
 		tempHistoryDate:   historyDate,
+	}
+
+	// Seed the skiplist and load the address labels and entities so they're
+	// available before the first capture
+	err = indexer.seedSkiplist()
+	if err != nil {
+		return nil, err
+	}
+	err = indexer.loadLabels()
+	if err != nil {
+		return nil, err
+	}
+	err = indexer.loadEntities()
+	if err != nil {
+		return nil, err
+	}
+
+	return indexer, nil
+}
+
+// ReaderConfig is the config of an indexer that only reads the database and
+// the chain, a subset of Config
+type ReaderConfig struct {
+	DatabaseDSN             string `envconfig:"DATABASE_DSN" required:"true" validate:"dsn" secret:"true"`
+	RPCEndpoint             string `envconfig:"RPC_ENDPOINT" required:"true" validate:"url"`
+	LCDEndpoint             string `envconfig:"LCD_ENDPOINT" required:"false" validate:"url"`
+	QueryTransport          string `envconfig:"QUERY_TRANSPORT" default:"rpc"`
+	DropletsContractAddress string `envconfig:"DROPLETS_CONTRACT_ADDRESS" required:"true" validate:"contract"`
+
+	RetryAttempts int           `envconfig:"RETRY_ATTEMPTS" default:"3"`
+	RetryBackoff  time.Duration `envconfig:"RETRY_BACKOFF" default:"2s"`
+}
+
+// NewReader returns an indexer for the operational commands that inspect the
+// database and the chain. Unlike New it doesn't migrate the schema or load
+// the label and entity files, and it can't run passes
+func NewReader(log *logrus.Entry) (*Indexer, error) {
+	var config ReaderConfig
+	err := envconfig.Process("", &config)
+	if err != nil {
+		return nil, fmt.Errorf("unable to process config: %v", err)
+	}
+	switch strings.ToLower(config.QueryTransport) {
+	case TransportRPC:
+	case TransportLCD:
+		if config.LCDEndpoint == "" {
+			return nil, fmt.Errorf("LCD_ENDPOINT is required for the %s query transport", TransportLCD)
+		}
+	default:
+		return nil, fmt.Errorf("unknown query transport %q, use %s or %s",
+			config.QueryTransport, TransportRPC, TransportLCD)
+	}
+
+	db, err := gorm.Open(postgres.Open(config.DatabaseDSN), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Indexer{
+		rpcEndpoint:             config.RPCEndpoint,
+		lcdEndpoint:             config.LCDEndpoint,
+		queryTransport:          strings.ToLower(config.QueryTransport),
+		dropletsContractAddress: config.DropletsContractAddress,
+		logger:                  log,
+		db:                      db,
+		checkedContracts:        make(map[string]bool),
+		retryAttempts:           config.RetryAttempts,
+		retryBackoff:            config.RetryBackoff,
 	}, nil
 }
 
-// Run the indexer service forever
-func (i *Indexer) Run() error {
+// Migrate creates the tables owned by the indexer and adds its columns to
+// the tables shared with the dashboard. Only the commands that write
+// snapshots run it
+func Migrate(db *gorm.DB) error {
+	// Statuses stored before declining balances had their own status
+	// counted them as active, they are classified again
+	reclassify := db.Migrator().HasTable(&models.DropletStatusHistory{}) &&
+		!db.Migrator().HasColumn(&models.DropletStatusHistory{}, "Declining")
+
+	// Create the tables owned by the indexer
+	err := db.AutoMigrate(
+		&models.DropletAddressRate{},
+		&models.DropletAddressPosition{},
+		&models.DropletDistributionHistory{},
+		&models.DropletRankTier{},
+		&models.DropletAddressStatus{},
+		&models.DropletStatusHistory{},
+		&models.DropletCohort{},
+		&models.SkiplistEntry{},
+		&models.DropletExclusionHistory{},
+		&models.AddressLabel{},
+		&models.DropletKeyQuarantine{},
+		&models.Entity{},
+		&models.EntityAddress{},
+		&models.EntityHistory{},
+		&models.SnapshotQuarantine{},
+		&models.IndexerRun{},
+		&models.ContractStateArchive{},
+	)
+	if err != nil {
+		return err
+	}
+
+	if reclassify {
+		for _, table := range []string{"droplet_address_status", "droplet_status_history", "droplet_cohort"} {
+			err = db.Exec("DELETE FROM " + table).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Removed skiplist entries are kept, the address of one can be added
+	// again
+	if db.Migrator().HasIndex(&models.SkiplistEntry{}, "idx_skiplist_address") {
+		err = db.Migrator().DropIndex(&models.SkiplistEntry{}, "idx_skiplist_address")
+		if err != nil {
+			return err
+		}
+	}
+
+	// Columns added to the tables shared with the dashboard
+	for _, column := range []struct {
+		model any
+		name  string
+	}{
+		{&models.DropletAddressHistory{}, "Excluded"},
+		{&models.DropletStatsHistory{}, "TotalDropletsAll"},
+		{&models.DropletStatsHistory{}, "TotalAddressesAll"},
+		{&models.DropletStatsHistory{}, "VerificationStatus"},
+		{&models.DropletStatsHistory{}, "KeysScanned"},
+		{&models.DropletStatsHistory{}, "TotalSupply"},
+	} {
+		if !db.Migrator().HasColumn(column.model, column.name) {
+			err = db.Migrator().AddColumn(column.model, column.name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Run the indexer service until ctx is done or Stop is called. A stop
+// during a capture rolls back the snapshot being stored and returns
+// context.Canceled
+func (i *Indexer) Run(ctx context.Context) error {
 	i.logger.Info("Starting indexer")
 
+	ctx, release := i.cancellable(ctx)
+	defer release()
+
+	ctx, span := tracer.Start(ctx, "pass")
+
+	// Record the pass in the run ledger
+	run := i.startRun()
+	err := i.pass(ctx, run)
+	i.finishRun(run, err)
+
+	span.SetAttributes(
+		attribute.String("outcome", run.Outcome),
+		attribute.Int64("height", run.Height),
+	)
+	endSpan(span, err)
+	return err
+}
+
+// Daemon runs a pass every configured interval until ctx is cancelled. A
+// failed pass is recorded in the run ledger and logged, the next one still
+// runs on schedule
+func (i *Indexer) Daemon(ctx context.Context) error {
+	ctx, release := i.cancellable(ctx)
+	defer release()
+
+	for {
+		err := i.Run(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			i.logger.WithFields(logrus.Fields{
+				"kind": KindOf(err),
+				"err":  err,
+			}).Error("Pass failed")
+		}
+
+		i.logger.WithFields(logrus.Fields{
+			"interval": i.passInterval,
+		}).Info("Waiting for the next pass")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(i.passInterval):
+		}
+	}
+}
+
+// pass checks for a new on-chain update and captures it, recording what it
+// did in run
+func (i *Indexer) pass(ctx context.Context, run *models.IndexerRun) error {
+
 	// BACKFILL CODE
 
 	// fmt.Println("Temp history height:", i.tempHistoryHeight)
@@ -114,296 +434,397 @@ func (i *Indexer) Run() error {
 	// END OF BACKFILL CODE
 
 	i.logger.Info("Fetching last on-chain update")
-	height, lastOnchainUpdateTime, error := i.getLastOnChainUpdate()
-	if error != nil {
+	detectCtx, detectSpan := tracer.Start(ctx, "detect_update")
+	var height int64
+	var lastOnchainUpdateTime time.Time
+	err := i.retry(detectCtx, "detect update", func() (err error) {
+		height, lastOnchainUpdateTime, err = i.getLastOnChainUpdate(detectCtx)
+		return err
+	})
+	detectSpan.SetAttributes(attribute.Int64("height", height))
+	endSpan(detectSpan, err)
+	observeUpdateCheck(err)
+	if err != nil {
 		i.logger.Error("Failed to get last point update")
-		return error
+		return err
 	}
 
 	i.logger.WithFields(logrus.Fields{
 		"height": height,
 		"date":   lastOnchainUpdateTime,
 	}).Info("Last on-chain update")
+	run.Height = height
+	run.DateOnchainUpdate = &lastOnchainUpdateTime
 
 	// Fetch last update we captured
 	i.logger.Info("Fetching last captured update")
 	var lastCapture models.DropletStatsHistory
-	result := i.db.Order("height DESC").First(&lastCapture)
-	if result.Error != nil {
-		if result.Error != gorm.ErrRecordNotFound {
-			i.logger.WithFields(logrus.Fields{
-				"err": result.Error,
-			}).Fatal("Unable to fetch last stats")
+	err = i.retry(ctx, "fetch last stats", func() error {
+		result := i.db.Order("height DESC").First(&lastCapture)
+		if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+			return dbError("fetch last stats", result.Error)
 		}
+		return nil
+	})
+	if err != nil {
+		i.logger.Error("Failed to fetch last stats")
+		return err
 	}
 
 	i.logger.WithFields(logrus.Fields{
 		"height": lastCapture.Height,
 		"date":   lastCapture.DateBlock,
 	}).Info("Last captured update")
+	lastCapturedHeight.Set(float64(lastCapture.Height))
+	heightLag.Set(float64(height - lastCapture.Height))
 
-	// Check if the latest on-chain is newer than what we've captured
-	// If so, update Droplets
-	if lastCapture.Height < height {
-		i.logger.Info("Updating Drop Staked ATOM")
+	// A quarantined snapshot isn't captured again until it is approved
+	held, err := i.snapshotHeld(height)
+	if err != nil {
+		i.logger.Error("Failed to check snapshot quarantine")
+		return dbError("check snapshot quarantine", err)
+	}
+	if held {
+		i.logger.WithFields(logrus.Fields{
+			"height": height,
+		}).Warn("Snapshot is quarantined, waiting for approval")
+		run.Outcome = models.IndexerRunQuarantined
+	}
+	i.observeUpdate(height, lastOnchainUpdateTime, lastCapture.Height, held)
 
-		dropStakedAtom, err := i.getDropStakedAtom(height)
+	// Snapshots approved after a newer update arrived are captured first, so
+	// the newer one is checked against them. Only one newer than the last
+	// capture replaces the leaderboard
+	approved, err := i.approvedUncaptured(height)
+	if err != nil {
+		i.logger.Error("Failed to fetch approved snapshots")
+		return dbError("fetch approved snapshots", err)
+	}
+	for _, approvedHeight := range approved {
+		publish := approvedHeight > lastCapture.Height
+		outcome, err := i.backfillHeight(ctx, approvedHeight, publish)
 		if err != nil {
-			i.logger.Error("Failed to get Drop staked ATOM")
+			i.logger.WithFields(logrus.Fields{
+				"height": approvedHeight,
+			}).Error("Failed to capture approved snapshot")
 			return err
 		}
-		// Save the Drop staked ATOM totals
-		dropStakedAtomModel := models.DropAtomHistory{
-			TotalAtom:   dropStakedAtom,
-			Height:      height,
-			DateBlock:   lastOnchainUpdateTime,
-			DateCreated: time.Now(),
-		}
-		result := i.db.Save(&dropStakedAtomModel)
-		if result.Error != nil {
-			// If the error is a duplicate key error, we ignore it
-			if result.Error != gorm.ErrDuplicatedKey && !strings.Contains(result.Error.Error(), "duplicate key value") {
-				i.logger.WithFields(logrus.Fields{
-					"total": dropStakedAtom,
-					"err":   result.Error,
-				}).Fatal("Unable to store Drop staked ATOM")
-			}
+		if outcome == models.IndexerRunCaptured && publish {
+			lastCapture.Height = approvedHeight
 		}
+	}
 
-		i.logger.Info("Updating Droplets")
+	// Check if the latest on-chain is newer than what we've captured
+	// If so, update Droplets
+	if lastCapture.Height < height && !held {
+		err = i.capture(ctx, run, height, lastOnchainUpdateTime, true)
+		if err != nil || run.Outcome != models.IndexerRunCaptured {
+			return err
+		}
+		lastCapturedHeight.Set(float64(height))
+		heightLag.Set(0)
+		i.observeCapture(height)
+
+		// The snapshot is stored, the analytics are left to the next pass
+		// when stopping
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
-		// Set the offset key to empty
-		offsetKey := bytes.HexBytes{}
-		// RPCs typically have a 100 item limit per request
-		limit := uint64(100)
-		var addressDroplets []AddressDroplets
+		_, analyticsSpan := tracer.Start(ctx, "analytics")
 
-		lastKey, fetchedDroplets, err := i.getDroplets(height, offsetKey, limit)
+		// Refit the earning rates now that the new snapshot is stored
+		err = i.updateEarningRates(height, lastOnchainUpdateTime)
 		if err != nil {
-			i.logger.Error("Failed to get all droplets")
-			return err
+			i.logger.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("Unable to update earning rates")
 		}
-		addressDroplets = append(addressDroplets, fetchedDroplets...)
 
-		for len(fetchedDroplets) >= int(limit) {
-			// Move on to the next batch
-			lastKey, fetchedDroplets, err = i.getDroplets(height, lastKey, limit)
-			if err != nil {
-				i.logger.Error("Failed to get all droplets")
-				return err
-			}
-			addressDroplets = append(addressDroplets, fetchedDroplets...)
+		// Estimate dATOM positions from the Droplets accrued since the
+		// previous snapshot
+		err = i.updatePositions(height, lastOnchainUpdateTime)
+		if err != nil {
 			i.logger.WithFields(logrus.Fields{
-				"total": len(addressDroplets),
-			}).Debug("Droplets fetched")
-
-			// Slow down to not query too hard
-			time.Sleep(time.Millisecond * 500)
+				"err": err,
+			}).Error("Unable to update positions")
 		}
 
-		// Truncate the leaderboard
-		result = i.db.Exec("TRUNCATE TABLE droplet_leaderboard")
-		if result.Error != nil {
+		// Compute the distribution of this and any earlier snapshot
+		// without one
+		err = i.updateDistributions()
+		if err != nil {
 			i.logger.WithFields(logrus.Fields{
-				"err": result.Error,
-			}).Fatal("Unable to truncate leaderboard")
+				"err": err,
+			}).Error("Unable to update distributions")
 		}
-		i.logger.Debug("Leaderboard truncated")
-
-		i.logger.Info("Processing Droplets")
-
-		// Capture all the droplets for datetime/lastOnchainUpdateTime
-		for _, account := range addressDroplets {
-
-			// Check if account.Address is in the skiplist, if so, continue to
-			// the next account
-			if len(i.skipList) > 0 {
-				skip := false
-				for _, skipAddress := range i.skipList {
-					if strings.Contains(account.Address, skipAddress) {
-						i.logger.WithFields(logrus.Fields{
-							"address": account.Address,
-						}).Debug("Skipping address")
-						skip = true
-						break
-					}
-				}
-				if skip {
-					continue
-				}
-			}
-
-			// Store the history item
-			historyModel := models.DropletAddressHistory{
-				Address:     account.Address,
-				Droplets:    account.Droplets,
-				Height:      height,
-				DateBlock:   lastOnchainUpdateTime,
-				DateCreated: time.Now(),
-			}
-			result := i.db.Save(&historyModel)
-			if result.Error != nil {
-				// If the error is a duplicate key error, we ignore it
-				if result.Error != gorm.ErrDuplicatedKey && !strings.Contains(result.Error.Error(), "duplicate key value") {
-					i.logger.WithFields(logrus.Fields{
-						"address":  account.Address,
-						"droplets": account.Droplets,
-						"err":      result.Error,
-					}).Fatal("Unable to store history")
-				}
-			}
 
-			// Add to the leaderboard
-			leaderboardModel := models.DropletLeaderboard{
-				Address:  account.Address,
-				Droplets: account.Droplets,
-				Height:   height,
-
-				DateBlock:   lastOnchainUpdateTime,
-				DateCreated: time.Now(),
-			}
-			result = i.db.Save(&leaderboardModel)
-			if result.Error != nil {
-				// If the error is a duplicate key error, we ignore it
-				if result.Error != gorm.ErrDuplicatedKey && !strings.Contains(result.Error.Error(), "duplicate key value") {
-					i.logger.WithFields(logrus.Fields{
-						"address":  account.Address,
-						"droplets": account.Droplets,
-						"err":      result.Error,
-					}).Fatal("Unable to store leaderboard item")
-				} else {
-					continue
-				}
-			}
+		// Precompute the rank tiers the same way
+		err = i.updateRankTiers()
+		if err != nil {
+			i.logger.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("Unable to update rank tiers")
 		}
 
-		// Rank the leaderboard
-		rankingQuery := `
-		WITH ranked_droplets AS (
-		SELECT
-			id,
-			ROW_NUMBER() OVER (ORDER BY droplets DESC) AS rank  -- Calculate rank based on descending order of 'droplets'
-		FROM
-			droplet_leaderboard
-		)
-		UPDATE droplet_leaderboard
-		SET position = ranked_droplets.rank  -- Update the 'position' column with the calculated rank
-		FROM ranked_droplets
-		WHERE droplet_leaderboard.id = ranked_droplets.id;  -- Match each row by 'id' 
-	`
-		result = i.db.Exec(rankingQuery)
-		if result.Error != nil {
+		// Classify new, active, dormant and dropped addresses
+		err = i.updateAddressStatuses()
+		if err != nil {
 			i.logger.WithFields(logrus.Fields{
-				"err": result.Error,
-			}).Fatal("Unable to rank leaderboard")
+				"err": err,
+			}).Error("Unable to update address statuses")
 		}
 
-		i.logger.Info("Leaderboard rankes inserted")
+		// Extend the cohort tables with the classified snapshots
+		err = i.updateCohorts()
+		if err != nil {
+			i.logger.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("Unable to update cohorts")
+		}
 
-		// Count unique addresses in the dashboard
-		var totalUniqueAddresses int64
-		result = i.db.Model(&models.DropletLeaderboard{}).Select("DISTINCT(address)").Count(&totalUniqueAddresses)
-		if result.Error != nil {
+		// Label any new contract addresses
+		err = i.detectContractLabels(ctx, height)
+		if err != nil {
 			i.logger.WithFields(logrus.Fields{
-				"err": result.Error,
-			}).Fatal("Unable to count unique addresses")
+				"err": err,
+			}).Error("Unable to detect contract labels")
 		}
+		analyticsSpan.End()
+	}
+
+	// Entities can change between captures, so their history is brought up
+	// to date on every pass
+	_, entitiesSpan := tracer.Start(ctx, "entities")
+	err = i.updateEntities()
+	endSpan(entitiesSpan, err)
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Unable to update entities")
+	}
+
+	// The daemon checks again after PASS_INTERVAL. We could wait much
+	// longer, but if we capture in the middle of an update by the Drop team,
+	// we might have a long delay, instead we can check more often since it
+	// is a single API call that determines if we should capture
+	i.logger.Info("Wait for next run")
+
+	return nil
+}
 
-		// Count total droplets in the dashboard
-		var totalDroplets int64
-		// Sum the droplets
-		result = i.db.Model(&models.DropletLeaderboard{}).Select("SUM(droplets)").Scan(&totalDroplets)
-		if result.Error != nil {
+// capture fetches the contract state at height, checks it and stores it as a
+// snapshot taken at dateBlock, setting the outcome of run. A published
+// snapshot replaces the leaderboard, others are only added to the history
+func (i *Indexer) capture(
+	ctx context.Context,
+	run *models.IndexerRun,
+	height int64,
+	dateBlock time.Time,
+	publish bool) error {
+
+	i.logger.Info("Updating Drop Staked ATOM")
+
+	atomCtx, atomSpan := tracer.Start(ctx, "query.datom")
+	var dropStakedAtom uint64
+	err := i.retry(atomCtx, "query dATOM", func() (err error) {
+		dropStakedAtom, err = i.getDropStakedAtom(atomCtx, height)
+		return err
+	})
+	endSpan(atomSpan, err)
+	if err != nil {
+		i.logger.Error("Failed to get Drop staked ATOM")
+		return err
+	}
+
+	i.logger.Info("Updating Droplets")
+
+	stateCtx, stateSpan := tracer.Start(ctx, "fetch_state")
+	state, err := i.fetchState(stateCtx, height)
+	stateSpan.SetAttributes(
+		attribute.Int("pages", state.Pages),
+		attribute.Int("keys", state.Keys),
+	)
+	endSpan(stateSpan, err)
+	if err != nil {
+		i.logger.Error("Failed to get all droplets")
+		return err
+	}
+
+	// Fetch the total supply to verify against before the snapshot is
+	// stored, so no chain query runs inside the transaction
+	err = i.fetchTotalSupply(ctx, &state)
+	if err != nil {
+		return err
+	}
+	addressDroplets := state.Droplets
+	quarantined := state.Quarantined
+	run.PagesFetched = int64(state.Pages)
+	run.AddressesProcessed = int64(len(addressDroplets))
+	run.ParseWarnings = int64(len(quarantined))
+
+	// Keep the raw contract state so the snapshot can be reprocessed later
+	if i.stateArchive != ArchiveNone {
+		err = i.archiveState(ctx, state)
+		if err != nil {
 			i.logger.WithFields(logrus.Fields{
-				"err": result.Error,
-			}).Fatal("Unable to count total droplets")
+				"err": err,
+			}).Error("Unable to archive contract state")
 		}
+	}
 
+	// Keep the keys that failed validation for investigation
+	err = i.storeQuarantinedKeys(height, quarantined)
+	if err != nil {
 		i.logger.WithFields(logrus.Fields{
-			"total": totalDroplets,
-			"count": len(addressDroplets),
-		}).Info("Droplet history updated")
-
-		// Log the stats history
-		statsModel := models.DropletStatsHistory{
-			TotalDroplets:  totalDroplets,
-			TotalAddresses: totalUniqueAddresses,
-			Height:         height,
-
-			DateBlock:   lastOnchainUpdateTime,
-			DateCreated: time.Now(),
+			"err": err,
+		}).Error("Unable to store quarantined keys")
+	}
+
+	// Check the snapshot against the earlier ones before publishing it,
+	// unless it was reviewed and approved
+	approved, err := i.snapshotApproved(height)
+	if err != nil {
+		i.logger.Error("Failed to check snapshot approval")
+		return dbError("check snapshot approval", err)
+	}
+	if !approved {
+		reasons, err := i.checkSnapshot(state, dropStakedAtom, dateBlock)
+		if err != nil {
+			i.logger.Error("Failed to check snapshot for anomalies")
+			return dbError("check snapshot for anomalies", err)
 		}
-		result = i.db.Save(&statsModel)
-		if result.Error != nil {
-			// If the error is a duplicate key error, we ignore it
-			if result.Error != gorm.ErrDuplicatedKey && !strings.Contains(result.Error.Error(), "duplicate key value") {
-				i.logger.WithFields(logrus.Fields{
-					"total_address":  totalUniqueAddresses,
-					"total_droplets": totalDroplets,
-					"err":            result.Error,
-				}).Fatal("Unable to store stats item")
+		if len(reasons) > 0 {
+			err = i.quarantineSnapshot(state, dropStakedAtom, dateBlock, reasons)
+			if err != nil {
+				i.logger.Error("Failed to quarantine snapshot")
+				return dbError("quarantine snapshot", err)
 			}
+			i.logger.WithFields(logrus.Fields{
+				"height":  height,
+				"reasons": reasons,
+			}).Warn("Snapshot quarantined")
+			run.Outcome = models.IndexerRunQuarantined
+			i.observeHeld()
+			return nil
 		}
+	}
 
-		i.logger.Info("All Droplets processed")
+	skiplist, err := i.loadSkiplist()
+	if err != nil {
+		i.logger.Error("Failed to load skiplist")
+		return dbError("load skiplist", err)
 	}
 
-	// Now wait 30 minutes to see if we should update again
-	// We could wait much longer, but if we capture in the middle of an update
-	// by the Drop team, we might have a long delay, instead we can check more
-	// often since it is a single API call that determines if we should capture
-	// i.logger.Info("Waiting 30 minutes before next update")
-	// time.Sleep(time.Minute * 30)
-	i.logger.Info("Wait for next run")
+	// Store and publish the snapshot in a single transaction, so a
+	// failure or a stop rolls back everything written for it. The
+	// transaction is retried as a whole on transient failures
+	err = i.retry(ctx, "store snapshot", func() error {
+		run.AddressesSkipped = 0
+		err := i.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return i.storeSnapshot(ctx, tx, run, state, &dropStakedAtom, dateBlock, skiplist, publish)
+		})
+		var indexerError *Error
+		if err != nil && !errors.As(err, &indexerError) && ctx.Err() == nil {
+			// Errors of the snapshot are classified, this is the commit
+			return dbError("commit snapshot", err)
+		}
+		return err
+	})
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": err,
+		}).Error("Snapshot rolled back")
+		return err
+	}
 
+	i.logger.Info("All Droplets processed")
+	run.Outcome = models.IndexerRunCaptured
 	return nil
 }
 
-// Stop the indexer
+// cancellable returns a context Stop cancels, unless Stop already cancels an
+// outer one, such as the context of Daemon around its passes. release must
+// be called once the context is no longer used
+func (i *Indexer) cancellable(ctx context.Context) (context.Context, func()) {
+	i.cancelMutex.Lock()
+	defer i.cancelMutex.Unlock()
+	if i.cancel != nil {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	i.cancel = cancel
+	return ctx, func() {
+		i.cancelMutex.Lock()
+		i.cancel = nil
+		i.cancelMutex.Unlock()
+		cancel()
+	}
+}
+
+// Stop the indexer, cancelling the running pass or daemon
 func (i *Indexer) Stop() error {
 	i.logger.Info("Stopping indexer")
-	i.stopChannel <- true
-	i.stopChannel <- true
+	i.cancelMutex.Lock()
+	defer i.cancelMutex.Unlock()
+	if i.cancel != nil {
+		i.cancel()
+	}
 	return nil
 }
 
 // getLastOnChainUpdate gets the last time the points were updated on chain
 // We do this by querying the Celatone API for the last transaction that updated points
-func (i *Indexer) getLastOnChainUpdate() (int64, time.Time, error) {
-	response, err := http.Get(i.celatoneQuery)
+func (i *Indexer) getLastOnChainUpdate(ctx context.Context) (int64, time.Time, error) {
+	const op = "detect update"
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, i.celatoneQuery, nil)
+	if err != nil {
+		return 0, time.Time{}, permanentError(op, err)
+	}
+	response, err := http.DefaultClient.Do(request)
 	if err != nil {
 		i.logger.Error("Failed to get last point update")
-		return 0, time.Time{}, err
+		return 0, time.Time{}, requestError(op, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, time.Time{}, statusError(op, response)
 	}
 
 	var txResponse CelatoneTxResponse
 	err = json.NewDecoder(response.Body).Decode(&txResponse)
 	if err != nil {
 		i.logger.Error("Failed to parse last point update")
-		return 0, time.Time{}, err
+		return 0, time.Time{}, dataError(op, err)
 	}
 
 	// Loop through the items in the response and find the last time a tx was executed
 	// We could do better here, but this should be enough for now
 	for _, item := range txResponse.Items {
 		txTime, err := time.Parse("2006-01-02T15:04:05", item.Created)
-		return item.Height, txTime, err
+		if err != nil {
+			return 0, time.Time{}, dataError(op, err)
+		}
+		return item.Height, txTime, nil
 	}
 
-	return 0, time.Time{}, errors.New("no point update found")
+	return 0, time.Time{}, dataError(op, errors.New("no point update found"))
 }
 
-// getAllDroplets captures all the addresses and their Droplets by fetching the
-// raw contract state and parsing all the information
-func (i *Indexer) getDroplets(height int64, offsetKey bytes.HexBytes, limit uint64) (bytes.HexBytes, []AddressDroplets, error) {
+// getDroplets captures a page of addresses and their Droplets by fetching
+// the raw contract state and parsing all the information
+func (i *Indexer) getDroplets(ctx context.Context, height int64, offsetKey bytes.HexBytes, limit uint64) (StatePage, error) {
 	start := time.Now()
-	lastScannedKey := offsetKey
-	addressDroplets := []AddressDroplets{}
+	const op = "fetch state page"
+	page := StatePage{
+		LastKey: offsetKey,
+	}
 
 	// Create a new RPC client
 	client, err := rpchttp.New(i.rpcEndpoint)
 	if err != nil {
-		return lastScannedKey, addressDroplets, err
+		return page, permanentError(op, err)
 	}
 
 	// Create the state request
@@ -418,25 +839,28 @@ func (i *Indexer) getDroplets(height int64, offsetKey bytes.HexBytes, limit uint
 	// Marshal the request to protobuf
 	rpcRequest, err := proto.Marshal(&stateRequest)
 	if err != nil {
-		return lastScannedKey, addressDroplets, err
+		return page, permanentError(op, err)
 	}
 
 	// Perform the ABCI query
+	queryStart := time.Now()
 	rpcResponse, err := client.ABCIQueryWithOptions(
-		context.Background(),
+		ctx,
 		"/cosmwasm.wasm.v1.Query/AllContractState",
 		rpcRequest,
 		rpcclient.ABCIQueryOptions{Height: height, Prove: false},
 	)
+	rpcPageDuration.Observe(time.Since(queryStart).Seconds())
 	if err != nil {
-		return lastScannedKey, addressDroplets, err
+		return page, requestError(op, err)
 	}
 
-	// Handle the response
+	// Handle the response, the node refused the query, ie. the height was
+	// pruned
 	if rpcResponse.Response.Code != 0 {
-		fmt.Println("ABCI query error code:", rpcResponse.Response.Code)
-		fmt.Println("ABCI query log:", rpcResponse.Response.Log)
-		return lastScannedKey, addressDroplets, err
+		observeABCIError("/cosmwasm.wasm.v1.Query/AllContractState", rpcResponse.Response.Code)
+		return page, permanentError(op, fmt.Errorf("ABCI query failed with code %d: %s",
+			rpcResponse.Response.Code, rpcResponse.Response.Log))
 	}
 
 	// The value in the response also contains the contract state in
@@ -444,126 +868,52 @@ func (i *Indexer) getDroplets(height int64, offsetKey bytes.HexBytes, limit uint
 	var stateResponse QueryAllContractStateResponse
 	err = proto.Unmarshal(rpcResponse.Response.GetValue(), &stateResponse)
 	if err != nil {
-		return lastScannedKey, addressDroplets, err
-	}
-
-	// Structure of raw state we are querying
-	// If a contract has a cw-storage-plus Map "balances" then the raw
-	// state keys for that Map will have "balances" as a prefix. Here we need
-	// to filter out all the keys we're interested in by looking for the
-	// prefix
-	// Example: A contract Map "balances" containing MARS addresses as keys
-	// will have contract state keys returned as "balancesmars..."
-	for _, model := range stateResponse.Models {
-		// Example of a key
-		// 00056465627473002B6F736D6F316379797A7078706C78647A6B656561376B777379646164673837333537716E6168616B616B7375696F6E
-		// The first two bytes "0007" indicate the length of the Map "name" -> 7 characters
-		// Followed by the map key "62616C616E6365" -> 'balance'
-		// Followed by the rest of the key, the address in this case
-		hexKey := model.Key
-
-		// Skip any short keys that don't match what we're looking for
-		if len(hexKey) < 50 {
-			// Anything shorter than 50 can't be a map
-			continue
-		}
-
-		lengthIndicator := hexKey[0:2]
-		length, err := strconv.ParseInt(lengthIndicator.String(), 16, 64)
-		if err != nil {
-			i.logger.WithFields(logrus.Fields{
-				"err": err,
-				"key": hexKey.String(),
-			}).Warning("Unable to decode contract state key (map name)")
-			continue
-		}
-		// Shift to next section
-		hexKey = hexKey[2:]
-		// Get the map name
-		mapName := hexKey[0:length]
-		// Shift to next section
-		hexKey = hexKey[length:]
-
-		// Check if we're interested in this key
-		if !strings.Contains("balance", string(mapName)) {
-			continue
-		}
-
-		// The remaining part of the key is the address
-		address := string(hexKey)
-		// Strip "" from the value which is represented as "1234"
-		value := strings.ReplaceAll(string(model.Value), "\"", "")
-		// Parse the value as a string into a uint64
-		balance, err := strconv.ParseUint(value, 10, 64)
-		if err != nil {
-			i.logger.WithFields(logrus.Fields{
-				"err":     err,
-				"address": address,
-			}).Warning("Unable to decode contract state value (balance)")
-			continue
-		}
-
-		addressDroplets = append(addressDroplets, AddressDroplets{
-			Address:  address,
-			Droplets: balance,
-		})
+		return page, dataError(op, err)
+	}
 
-		lastScannedKey = model.Key
+	_, decodeSpan := tracer.Start(ctx, "decode")
+	page = decodeStateModels(stateResponse.Models)
+	page.Models = stateResponse.Models
+	decodeSpan.SetAttributes(
+		attribute.Int("keys", page.Keys),
+		attribute.Int("droplets", len(page.Droplets)),
+		attribute.Int("quarantined", len(page.Quarantined)),
+	)
+	decodeSpan.End()
+	page.NextKey = stateResponse.Pagination.GetNextKey()
+	stateKeys.WithLabelValues("decoded").Add(float64(len(page.Droplets)))
+	stateKeys.WithLabelValues("rejected").Add(float64(len(page.Quarantined)))
+	if page.LastKey == nil {
+		page.LastKey = offsetKey
 	}
+	for _, quarantined := range page.Quarantined {
+		i.logger.WithFields(logrus.Fields{
+			"key":    hex.EncodeToString(quarantined.Key),
+			"reason": quarantined.Reason,
+		}).Warning("Quarantined contract state key")
+	}
+
 	i.logger.WithFields(logrus.Fields{
-		"total":      len(addressDroplets),
-		"elapsed_ms": time.Since(start).Milliseconds(),
+		"total":       len(page.Droplets),
+		"quarantined": len(page.Quarantined),
+		"elapsed_ms":  time.Since(start).Milliseconds(),
 	}).Debug("Fetched contract items")
 
-	return lastScannedKey, addressDroplets, nil
+	return page, nil
 }
 
-// getDropStakedAtom fetches the current total Drop staked ATOM from the
+// getDropStakedAtom fetches the total Drop staked ATOM at height from the
 // core Drop contract
-func (i *Indexer) getDropStakedAtom(height int64) (uint64, error) {
-	// URL for the smart contract query
-	url := i.dropAtomQuery
-
-	// Create a new HTTP request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return 0, fmt.Errorf("failed to create HTTP request: %v", err)
-	}
-
-	// Set the required headers
-	req.Header.Set("x-cosmos-block-height", fmt.Sprintf("%d", height))
-	req.Header.Set("User-Agent", "DropletDashboard-Indexer")
-
-	// Execute the HTTP request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return 0, fmt.Errorf("failed to execute HTTP request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// Check if the response status is OK
-	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("received non-OK HTTP status: %s", resp.Status)
-	}
+func (i *Indexer) getDropStakedAtom(ctx context.Context, height int64) (uint64, error) {
+	const op = "query dATOM"
 
-	// Parse the response body
-	var result map[string]string
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	value, err := i.smartQuery(ctx, op, i.dropAtomQuery, height)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse response body: %v", err)
+		return 0, err
 	}
-
-	// Extract the "data" field from the response
-	dataStr, ok := result["data"]
-	if !ok {
-		return 0, fmt.Errorf("missing 'data' field in response")
-	}
-
-	// Convert the data string to uint64
-	data, err := strconv.ParseUint(dataStr, 10, 64)
+	data, err := uint64Value(value)
 	if err != nil {
-		return 0, fmt.Errorf("failed to convert data to uint64: %v", err)
+		return 0, dataError(op, fmt.Errorf("failed to convert data to uint64: %v", err))
 	}
 
 	// Log the fetched data
@@ -0,0 +1,98 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+)
+
+// AddressSnapshot is the balance of an address in a captured snapshot
+type AddressSnapshot struct {
+	Height    int64     `json:"height"`
+	Droplets  uint64    `json:"droplets"`
+	Excluded  bool      `json:"excluded"`
+	DateBlock time.Time `json:"date_block"`
+}
+
+// AddressInspection is the stored history of an address along with its live
+// on-chain balance
+type AddressInspection struct {
+	Address ResolvedAddress   `json:"address"`
+	History []AddressSnapshot `json:"history"`
+	// LiveHeight is the latest block the live balance was queried at
+	LiveHeight   int64  `json:"live_height"`
+	LiveDroplets uint64 `json:"live_droplets"`
+}
+
+// InspectAddress returns the stored history of input, resolved to its Neutron
+// address, and its balance at the latest block
+func (i *Indexer) InspectAddress(ctx context.Context, input string) (AddressInspection, error) {
+	resolved, err := ResolveAddress(input)
+	if err != nil {
+		return AddressInspection{}, err
+	}
+	inspection := AddressInspection{
+		Address: resolved,
+		History: []AddressSnapshot{},
+	}
+
+	var history []models.DropletAddressHistory
+	result := i.db.WithContext(ctx).
+		Where("address = ?", resolved.Address).
+		Order("height ASC").
+		Find(&history)
+	if result.Error != nil {
+		return inspection, dbError("fetch address history", result.Error)
+	}
+	for _, row := range history {
+		inspection.History = append(inspection.History, AddressSnapshot{
+			Height:    row.Height,
+			Droplets:  row.Droplets,
+			Excluded:  row.Excluded,
+			DateBlock: row.DateBlock,
+		})
+	}
+
+	inspection.LiveHeight, err = i.latestHeight(ctx)
+	if err != nil {
+		return inspection, err
+	}
+	inspection.LiveDroplets, err = i.liveBalance(ctx, resolved.Address, inspection.LiveHeight)
+	if err != nil {
+		return inspection, err
+	}
+	return inspection, nil
+}
+
+// liveBalance queries the cw20 balance of address in the Droplets contract at
+// height
+func (i *Indexer) liveBalance(ctx context.Context, address string, height int64) (uint64, error) {
+	const op = "query balance"
+
+	message, err := json.Marshal(map[string]any{
+		"balance": map[string]string{"address": address},
+	})
+	if err != nil {
+		return 0, permanentError(op, err)
+	}
+
+	var droplets uint64
+	err = i.retry(ctx, op, func() error {
+		value, err := i.smartQuery(ctx, op, SmartQuery{
+			Contract: i.dropletsContractAddress,
+			Message:  string(message),
+			Path:     "$.balance",
+		}, height)
+		if err != nil {
+			return err
+		}
+		droplets, err = uint64Value(value)
+		if err != nil {
+			return dataError(op, err)
+		}
+		return nil
+	})
+	return droplets, err
+}
@@ -0,0 +1,163 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cosmos/btcutil/bech32"
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm/clause"
+)
+
+// LabelCategories are the categories an address label can have
+var LabelCategories = []string{"dao", "contract", "cex", "team", "vault", "other"}
+
+// contractAccountLength is the length of a CosmWasm contract address, wallet
+// addresses are 20 bytes
+const contractAccountLength = 32
+
+// loadLabels stores the labels from the labels file, replacing any label
+// for the same address. The file is a JSON list of labels
+func (i *Indexer) loadLabels() error {
+	if i.labelsFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(i.labelsFile)
+	if err != nil {
+		return err
+	}
+	var labels []models.AddressLabel
+	err = json.Unmarshal(data, &labels)
+	if err != nil {
+		return fmt.Errorf("unable to parse labels file: %v", err)
+	}
+
+	for index := range labels {
+		label := &labels[index]
+		label.Address = strings.ToLower(strings.TrimSpace(label.Address))
+		if label.Address == "" || label.Name == "" {
+			return fmt.Errorf("label %d: address and name are required", index)
+		}
+		if label.Category == "" {
+			label.Category = "other"
+		}
+		if !containsString(LabelCategories, label.Category) {
+			return fmt.Errorf("label %d: category must be one of %s", index, strings.Join(LabelCategories, ", "))
+		}
+		if label.Source == "" {
+			label.Source = models.AddressLabelSourceFile
+		}
+		label.DateUpdated = time.Now()
+	}
+
+	if len(labels) > 0 {
+		result := i.db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "address"}},
+			DoUpdates: clause.AssignmentColumns([]string{"name", "category", "source", "date_updated"}),
+		}).Create(&labels)
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"count": len(labels),
+	}).Info("Labels loaded")
+	return nil
+}
+
+// detectContractLabels labels the contract addresses in the snapshot at
+// height with the label of the contract on chain. Addresses that already
+// have a label are left alone. A query that doesn't get an answer stops the
+// detection, leaving the address to be checked on the next pass
+func (i *Indexer) detectContractLabels(ctx context.Context, height int64) error {
+	var addresses []string
+	result := i.db.WithContext(ctx).Model(&models.DropletAddressHistory{}).
+		Where("height = ? AND address NOT IN (?)", height,
+			i.db.Model(&models.AddressLabel{}).Select("address")).
+		Pluck("address", &addresses)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	detected := 0
+	for _, address := range addresses {
+		if i.checkedContracts[address] {
+			continue
+		}
+		_, account, err := bech32.DecodeToBase256(address)
+		if err != nil || len(account) != contractAccountLength {
+			continue
+		}
+
+		// Slow down to not query too hard
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Millisecond * 100):
+		}
+
+		var response QueryContractInfoResponse
+		err = i.abciQuery(
+			ctx,
+			"/cosmwasm.wasm.v1.Query/ContractInfo",
+			&QueryContractInfoRequest{Address: address},
+			0,
+			&response,
+		)
+		// Only an answer of the node settles whether it is a contract
+		if err != nil && !errors.Is(err, errABCIQueryFailed) && KindOf(err) != KindData {
+			return err
+		}
+		i.checkedContracts[address] = true
+		if err != nil {
+			// Interchain accounts have the same length, but aren't contracts
+			i.logger.WithFields(logrus.Fields{
+				"address": address,
+				"err":     err,
+			}).Debug("Address is not a contract")
+			continue
+		}
+
+		name := response.ContractInfo.Label
+		if name == "" {
+			name = fmt.Sprintf("Contract (code %d)", response.ContractInfo.CodeID)
+		}
+		label := models.AddressLabel{
+			Address:     address,
+			Name:        name,
+			Category:    "contract",
+			Source:      models.AddressLabelSourceChain,
+			DateUpdated: time.Now(),
+		}
+		result = i.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&label)
+		if result.Error != nil {
+			return result.Error
+		}
+		detected++
+	}
+
+	if detected > 0 {
+		i.logger.WithFields(logrus.Fields{
+			"count": detected,
+		}).Info("Contract labels detected")
+	}
+	return nil
+}
+
+// containsString returns true if value is in values
+func containsString(values []string, value string) bool {
+	for _, item := range values {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package indexer
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"gorm.io/gorm"
+)
+
+// metricsNamespace prefixes every metric exposed by the indexer
+const metricsNamespace = "droplets_indexer"
+
+// Metrics exposed on /metrics through the default Prometheus registry
+var (
+	passDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "pass_duration_seconds",
+		Help:      "Duration of an indexer pass by outcome",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200},
+	}, []string{"outcome"})
+
+	rpcPageDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "rpc_page_duration_seconds",
+		Help:      "Latency of fetching a page of contract state from the RPC",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 2, 10),
+	})
+
+	abciErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "abci_errors_total",
+		Help:      "ABCI queries answered with a non-zero code, by query path and code",
+	}, []string{"path", "code"})
+
+	retries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "retries_total",
+		Help:      "Retried calls by operation",
+	}, []string{"operation"})
+
+	stateKeys = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "state_keys_total",
+		Help:      "Contract state balance keys by result, decoded or rejected",
+	}, []string{"result"})
+
+	dbWriteDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "db_write_duration_seconds",
+		Help:      "Latency of database writes by operation",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 8),
+	}, []string{"operation"})
+
+	lastCapturedHeight = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "last_captured_height",
+		Help:      "Height of the last captured snapshot",
+	})
+
+	heightLag = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "height_lag",
+		Help:      "Blocks between the last on-chain update and the last captured snapshot",
+	})
+
+	updateCheckSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "update_check_success",
+		Help:      "Whether the last check for an on-chain update succeeded",
+	})
+
+	updateCheckTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "update_check_timestamp_seconds",
+		Help:      "Unix time of the last check for an on-chain update",
+	})
+)
+
+// observeABCIError counts an ABCI query answered with a non-zero code
+func observeABCIError(path string, code uint32) {
+	abciErrors.WithLabelValues(path, strconv.FormatUint(uint64(code), 10)).Inc()
+}
+
+// observeUpdateCheck records the result of a check for an on-chain update
+func observeUpdateCheck(err error) {
+	updateCheckTimestamp.SetToCurrentTime()
+	if err != nil {
+		updateCheckSuccess.Set(0)
+		return
+	}
+	updateCheckSuccess.Set(1)
+}
+
+// metricsStartKey holds the start time of a statement in its gorm instance
+const metricsStartKey = "metrics:start"
+
+// registerDBMetrics times every write made through db
+func registerDBMetrics(db *gorm.DB) error {
+	before := func(tx *gorm.DB) {
+		tx.InstanceSet(metricsStartKey, time.Now())
+	}
+	after := func(operation string) func(*gorm.DB) {
+		return func(tx *gorm.DB) {
+			start, ok := tx.InstanceGet(metricsStartKey)
+			if !ok {
+				return
+			}
+			dbWriteDuration.WithLabelValues(operation).Observe(time.Since(start.(time.Time)).Seconds())
+		}
+	}
+
+	callbacks := db.Callback()
+	err := callbacks.Create().Before("gorm:create").Register("metrics:before_create", before)
+	if err != nil {
+		return err
+	}
+	err = callbacks.Create().After("gorm:create").Register("metrics:after_create", after("create"))
+	if err != nil {
+		return err
+	}
+	err = callbacks.Update().Before("gorm:update").Register("metrics:before_update", before)
+	if err != nil {
+		return err
+	}
+	err = callbacks.Update().After("gorm:update").Register("metrics:after_update", after("update"))
+	if err != nil {
+		return err
+	}
+	err = callbacks.Delete().Before("gorm:delete").Register("metrics:before_delete", before)
+	if err != nil {
+		return err
+	}
+	err = callbacks.Delete().After("gorm:delete").Register("metrics:after_delete", after("delete"))
+	if err != nil {
+		return err
+	}
+	err = callbacks.Raw().Before("gorm:raw").Register("metrics:before_raw", before)
+	if err != nil {
+		return err
+	}
+	return callbacks.Raw().After("gorm:raw").Register("metrics:after_raw", after("raw"))
+}
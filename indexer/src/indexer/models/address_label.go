@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// Address label sources
+const (
+	// AddressLabelSourceFile is a label loaded from the labels file
+	AddressLabelSourceFile = "file"
+	// AddressLabelSourceChain is a label detected from the contract info on
+	// chain
+	AddressLabelSourceChain = "chain"
+)
+
+// AddressLabel names an address and the kind of entity behind it
+type AddressLabel struct {
+	ID          uint64    `gorm:"primary_key" json:"-"`
+	Address     string    `gorm:"column:address;uniqueIndex" json:"address"`
+	Name        string    `gorm:"column:name" json:"name"`
+	Category    string    `gorm:"column:category" json:"category"`
+	Source      string    `gorm:"column:source" json:"source"`
+	DateUpdated time.Time `gorm:"column:date_updated" json:"date_updated"`
+}
+
+func (AddressLabel) TableName() string {
+	return "address_label"
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// ContractStateArchive is the raw contract state of the Droplets contract at
+// Height, the gzip compressed protobuf of every key and value fetched
+type ContractStateArchive struct {
+	ID          uint64    `gorm:"primary_key" json:"-"`
+	Height      int64     `gorm:"column:height;uniqueIndex" json:"height"`
+	Keys        int64     `gorm:"column:keys" json:"keys"`
+	Data        []byte    `gorm:"column:data" json:"-"`
+	SHA256      string    `gorm:"column:sha256" json:"sha256"`
+	DateCreated time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (ContractStateArchive) TableName() string {
+	return "contract_state_archive"
+}
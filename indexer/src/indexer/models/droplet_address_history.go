@@ -8,6 +8,7 @@ type DropletAddressHistory struct {
 	ID          uint64    `gorm:"primary_key"`
 	Address     string    `gorm:"column:address"`
 	Droplets    uint64    `gorm:"column:droplets"`
+	Excluded    bool      `gorm:"column:excluded;default:false"`
 	Height      int64     `gorm:"column:height"`
 	DateBlock   time.Time `gorm:"column:date_block"`
 	DateCreated time.Time `gorm:"column:date_created"`
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// DropletAddressPosition is the dATOM-equivalent position implied by the
+// Droplets an address accrued between PreviousHeight and Height
+type DropletAddressPosition struct {
+	ID             uint64    `gorm:"primary_key" json:"-"`
+	Address        string    `gorm:"column:address;uniqueIndex:idx_droplet_address_position_address_height" json:"address"`
+	Height         int64     `gorm:"column:height;uniqueIndex:idx_droplet_address_position_address_height;index" json:"height"`
+	PreviousHeight int64     `gorm:"column:previous_height" json:"previous_height"`
+	DropletDelta   int64     `gorm:"column:droplet_delta" json:"droplet_delta"`
+	RatePerDay     float64   `gorm:"column:rate_per_day" json:"rate_per_day"`
+	ProgramShare   float64   `gorm:"column:program_share" json:"program_share"`
+	ImpliedAtom    float64   `gorm:"column:implied_atom" json:"implied_atom"`
+	RateChange     float64   `gorm:"column:rate_change" json:"rate_change"`
+	Flagged        bool      `gorm:"column:flagged" json:"flagged"`
+	DateBlock      time.Time `gorm:"column:date_block" json:"date_block"`
+	DateCreated    time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (DropletAddressPosition) TableName() string {
+	return "droplet_address_position"
+}
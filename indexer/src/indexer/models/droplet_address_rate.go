@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// DropletAddressRate is the fitted Droplet earning rate (per day) for an
+// address over a rolling window ending at Height. The bounds of its 95%
+// confidence interval are NULL when there are too few samples
+type DropletAddressRate struct {
+	ID          uint64    `gorm:"primary_key"`
+	Address     string    `gorm:"column:address;uniqueIndex:idx_droplet_address_rate_address_window"`
+	WindowDays  int       `gorm:"column:window_days;uniqueIndex:idx_droplet_address_rate_address_window"`
+	Rate        float64   `gorm:"column:rate"`
+	RateLower   *float64  `gorm:"column:rate_lower"`
+	RateUpper   *float64  `gorm:"column:rate_upper"`
+	Samples     int       `gorm:"column:samples"`
+	Droplets    uint64    `gorm:"column:droplets"`
+	Height      int64     `gorm:"column:height"`
+	DateBlock   time.Time `gorm:"column:date_block"`
+	DateCreated time.Time `gorm:"column:date_created"`
+}
+
+func (DropletAddressRate) TableName() string {
+	return "droplet_address_rate"
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"time"
+)
+
+// Address statuses assigned to every address in a snapshot
+const (
+	// AddressStatusNew is an address seen for the first time
+	AddressStatusNew = "new"
+	// AddressStatusActive is an address whose balance grew
+	AddressStatusActive = "active"
+	// AddressStatusDeclining is an address whose balance fell
+	AddressStatusDeclining = "declining"
+	// AddressStatusIdle is an address whose balance is unchanged for fewer
+	// than the dormant threshold of updates
+	AddressStatusIdle = "idle"
+	// AddressStatusDormant is an address whose balance is unchanged for at
+	// least the dormant threshold of updates
+	AddressStatusDormant = "dormant"
+	// AddressStatusDropped is an address that is gone from the contract state
+	AddressStatusDropped = "dropped"
+)
+
+// DropletAddressStatus classifies an address in the snapshot at Height
+type DropletAddressStatus struct {
+	ID              uint64    `gorm:"primary_key" json:"-"`
+	Address         string    `gorm:"column:address;uniqueIndex:idx_droplet_address_status_height_address" json:"address"`
+	Height          int64     `gorm:"column:height;uniqueIndex:idx_droplet_address_status_height_address;index:idx_droplet_address_status_height_status" json:"height"`
+	Status          string    `gorm:"column:status;index:idx_droplet_address_status_height_status" json:"status"`
+	Droplets        uint64    `gorm:"column:droplets" json:"droplets"`
+	UnchangedCount  int       `gorm:"column:unchanged_count" json:"unchanged_count"`
+	FirstSeenHeight int64     `gorm:"column:first_seen_height" json:"first_seen_height"`
+	DateBlock       time.Time `gorm:"column:date_block" json:"date_block"`
+	DateCreated     time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (DropletAddressStatus) TableName() string {
+	return "droplet_address_status"
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// DropletCohort tracks the addresses first seen at CohortHeight in the
+// snapshot at Height
+type DropletCohort struct {
+	ID            uint64    `gorm:"primary_key" json:"-"`
+	CohortHeight  int64     `gorm:"column:cohort_height;uniqueIndex:idx_droplet_cohort_cohort_height_height" json:"cohort_height"`
+	Height        int64     `gorm:"column:height;uniqueIndex:idx_droplet_cohort_cohort_height_height" json:"height"`
+	CohortSize    int64     `gorm:"column:cohort_size" json:"cohort_size"`
+	Retained      int64     `gorm:"column:retained" json:"retained"`
+	Retention     float64   `gorm:"column:retention" json:"retention"`
+	MedianBalance uint64    `gorm:"column:median_balance" json:"median_balance"`
+	DropletShare  float64   `gorm:"column:droplet_share" json:"droplet_share"`
+	DateBlock     time.Time `gorm:"column:date_block" json:"date_block"`
+	DateCreated   time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (DropletCohort) TableName() string {
+	return "droplet_cohort"
+}
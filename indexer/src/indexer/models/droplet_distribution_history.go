@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// DropletDistributionHistory holds the distribution metrics of the Droplet
+// balances in the snapshot at Height
+type DropletDistributionHistory struct {
+	ID           uint64    `gorm:"primary_key" json:"-"`
+	Height       int64     `gorm:"column:height;uniqueIndex" json:"height"`
+	Addresses    int64     `gorm:"column:addresses" json:"addresses"`
+	Median       uint64    `gorm:"column:median" json:"median"`
+	P90          uint64    `gorm:"column:p90" json:"p90"`
+	P99          uint64    `gorm:"column:p99" json:"p99"`
+	P999         uint64    `gorm:"column:p999" json:"p999"`
+	Top10Share   float64   `gorm:"column:top10_share" json:"top10_share"`
+	Top100Share  float64   `gorm:"column:top100_share" json:"top100_share"`
+	Top1000Share float64   `gorm:"column:top1000_share" json:"top1000_share"`
+	Gini         float64   `gorm:"column:gini" json:"gini"`
+	Herfindahl   float64   `gorm:"column:herfindahl" json:"herfindahl"`
+	DateBlock    time.Time `gorm:"column:date_block" json:"date_block"`
+	DateCreated  time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (DropletDistributionHistory) TableName() string {
+	return "droplet_distribution_history"
+}
@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+)
+
+// DropletExclusionHistory records an address excluded by a skiplist entry in
+// the snapshot at Height
+type DropletExclusionHistory struct {
+	ID              uint64    `gorm:"primary_key" json:"-"`
+	Address         string    `gorm:"column:address;uniqueIndex:idx_droplet_exclusion_history_height_address" json:"address"`
+	Height          int64     `gorm:"column:height;uniqueIndex:idx_droplet_exclusion_history_height_address" json:"height"`
+	Droplets        uint64    `gorm:"column:droplets" json:"droplets"`
+	SkiplistEntryID uint64    `gorm:"column:skiplist_entry_id" json:"skiplist_entry_id"`
+	Category        string    `gorm:"column:category" json:"category"`
+	Reason          string    `gorm:"column:reason" json:"reason"`
+	DateBlock       time.Time `gorm:"column:date_block" json:"date_block"`
+	DateCreated     time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (DropletExclusionHistory) TableName() string {
+	return "droplet_exclusion_history"
+}
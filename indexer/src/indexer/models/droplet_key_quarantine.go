@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// DropletKeyQuarantine is a raw balance entry of the contract state that
+// failed validation in the snapshot at Height
+type DropletKeyQuarantine struct {
+	ID          uint64    `gorm:"primary_key" json:"-"`
+	Height      int64     `gorm:"column:height;uniqueIndex:idx_droplet_key_quarantine_height_raw_key" json:"height"`
+	RawKey      string    `gorm:"column:raw_key;uniqueIndex:idx_droplet_key_quarantine_height_raw_key" json:"raw_key"`
+	RawValue    string    `gorm:"column:raw_value" json:"raw_value"`
+	Reason      string    `gorm:"column:reason" json:"reason"`
+	DateCreated time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (DropletKeyQuarantine) TableName() string {
+	return "droplet_key_quarantine"
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// DropletRankTier is the number of Droplets needed to reach a rank, or a
+// percentile of addresses, in the snapshot at Height
+type DropletRankTier struct {
+	ID          uint64    `gorm:"primary_key" json:"-"`
+	Height      int64     `gorm:"column:height;uniqueIndex:idx_droplet_rank_tier_height_tier" json:"height"`
+	Tier        string    `gorm:"column:tier;uniqueIndex:idx_droplet_rank_tier_height_tier" json:"tier"`
+	Rank        int64     `gorm:"column:rank" json:"rank"`
+	Percentile  float64   `gorm:"column:percentile" json:"percentile"`
+	Droplets    uint64    `gorm:"column:droplets" json:"droplets"`
+	DateBlock   time.Time `gorm:"column:date_block" json:"date_block"`
+	DateCreated time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (DropletRankTier) TableName() string {
+	return "droplet_rank_tier"
+}
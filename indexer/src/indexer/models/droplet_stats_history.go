@@ -5,12 +5,17 @@ import (
 )
 
 type DropletStatsHistory struct {
-	ID             uint64    `gorm:"primary_key"`
-	TotalDroplets  int64     `gorm:"column:total_droplets"`
-	TotalAddresses int64     `gorm:"column:total_addresses"`
-	Height         int64     `gorm:"column:height"`
-	DateBlock      time.Time `gorm:"column:date_block"`
-	DateCreated    time.Time `gorm:"column:date_created"`
+	ID                 uint64    `gorm:"primary_key"`
+	TotalDroplets      int64     `gorm:"column:total_droplets"`
+	TotalAddresses     int64     `gorm:"column:total_addresses"`
+	TotalDropletsAll   int64     `gorm:"column:total_droplets_all"`
+	TotalAddressesAll  int64     `gorm:"column:total_addresses_all"`
+	VerificationStatus string    `gorm:"column:verification_status"`
+	KeysScanned        int64     `gorm:"column:keys_scanned"`
+	TotalSupply        int64     `gorm:"column:total_supply"`
+	Height             int64     `gorm:"column:height"`
+	DateBlock          time.Time `gorm:"column:date_block"`
+	DateCreated        time.Time `gorm:"column:date_created"`
 }
 
 func (DropletStatsHistory) TableName() string {
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+)
+
+// DropletStatusHistory holds the number of addresses in each status for the
+// snapshot at Height
+type DropletStatusHistory struct {
+	ID          uint64    `gorm:"primary_key" json:"-"`
+	Height      int64     `gorm:"column:height;uniqueIndex" json:"height"`
+	New         int64     `gorm:"column:new" json:"new"`
+	Active      int64     `gorm:"column:active" json:"active"`
+	Declining   int64     `gorm:"column:declining" json:"declining"`
+	Idle        int64     `gorm:"column:idle" json:"idle"`
+	Dormant     int64     `gorm:"column:dormant" json:"dormant"`
+	Dropped     int64     `gorm:"column:dropped" json:"dropped"`
+	DateBlock   time.Time `gorm:"column:date_block" json:"date_block"`
+	DateCreated time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (DropletStatusHistory) TableName() string {
+	return "droplet_status_history"
+}
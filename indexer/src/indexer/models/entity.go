@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+)
+
+// Entity sources
+const (
+	// EntitySourceUser is an entity declared through the API
+	EntitySourceUser = "user"
+	// EntitySourceConfig is an entity declared in the entities file
+	EntitySourceConfig = "config"
+)
+
+// Entity groups several addresses held by the same owner
+type Entity struct {
+	ID          uint64    `gorm:"primary_key" json:"id"`
+	Name        string    `gorm:"column:name;uniqueIndex" json:"name"`
+	Source      string    `gorm:"column:source" json:"source"`
+	DateCreated time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (Entity) TableName() string {
+	return "entity"
+}
+
+// EntityAddress is an address belonging to an entity. An address belongs to
+// one entity at most so that no Droplets are counted twice
+type EntityAddress struct {
+	ID       uint64 `gorm:"primary_key" json:"-"`
+	EntityID uint64 `gorm:"column:entity_id;index" json:"entity_id"`
+	Address  string `gorm:"column:address;uniqueIndex" json:"address"`
+}
+
+func (EntityAddress) TableName() string {
+	return "entity_address"
+}
+
+// EntityHistory is the combined Droplets of an entity's addresses and its
+// position among entities and ungrouped addresses in the snapshot at Height
+type EntityHistory struct {
+	ID          uint64    `gorm:"primary_key" json:"-"`
+	EntityID    uint64    `gorm:"column:entity_id;uniqueIndex:idx_entity_history_entity_id_height" json:"entity_id"`
+	Height      int64     `gorm:"column:height;uniqueIndex:idx_entity_history_entity_id_height" json:"height"`
+	Droplets    uint64    `gorm:"column:droplets" json:"droplets"`
+	Addresses   int64     `gorm:"column:addresses" json:"addresses"`
+	Position    int64     `gorm:"column:position" json:"position"`
+	DateBlock   time.Time `gorm:"column:date_block" json:"date_block"`
+	DateCreated time.Time `gorm:"column:date_created" json:"date_created"`
+}
+
+func (EntityHistory) TableName() string {
+	return "entity_history"
+}
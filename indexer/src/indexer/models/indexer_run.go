@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+)
+
+// Outcomes of an indexer pass
+const (
+	// IndexerRunRunning is a pass that hasn't finished
+	IndexerRunRunning = "running"
+	// IndexerRunCaptured is a pass that captured a new snapshot
+	IndexerRunCaptured = "captured"
+	// IndexerRunSkipped is a pass that found no new on-chain update
+	IndexerRunSkipped = "skipped"
+	// IndexerRunQuarantined is a pass whose snapshot failed the anomaly
+	// guards or was already waiting for approval
+	IndexerRunQuarantined = "quarantined"
+	// IndexerRunFailed is a pass that stopped on an error
+	IndexerRunFailed = "failed"
+	// IndexerRunStopped is a pass cancelled by a shutdown
+	IndexerRunStopped = "stopped"
+)
+
+// IndexerRun is the ledger entry of a single indexer pass
+type IndexerRun struct {
+	ID                 uint64     `gorm:"primary_key" json:"id"`
+	Outcome            string     `gorm:"column:outcome;index" json:"outcome"`
+	Height             int64      `gorm:"column:height" json:"height"`
+	DateOnchainUpdate  *time.Time `gorm:"column:date_onchain_update" json:"date_onchain_update,omitempty"`
+	PagesFetched       int64      `gorm:"column:pages_fetched" json:"pages_fetched"`
+	AddressesProcessed int64      `gorm:"column:addresses_processed" json:"addresses_processed"`
+	AddressesSkipped   int64      `gorm:"column:addresses_skipped" json:"addresses_skipped"`
+	ParseWarnings      int64      `gorm:"column:parse_warnings" json:"parse_warnings"`
+	RPCEndpoint        string     `gorm:"column:rpc_endpoint" json:"rpc_endpoint"`
+	Error              string     `gorm:"column:error" json:"error,omitempty"`
+	Version            string     `gorm:"column:version" json:"version"`
+	DateStarted        time.Time  `gorm:"column:date_started;index" json:"date_started"`
+	DateFinished       *time.Time `gorm:"column:date_finished" json:"date_finished,omitempty"`
+}
+
+func (IndexerRun) TableName() string {
+	return "indexer_runs"
+}
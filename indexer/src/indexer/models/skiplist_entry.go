@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Skiplist match modes
+const (
+	// SkiplistMatchExact matches the address string exactly
+	SkiplistMatchExact = "exact"
+	// SkiplistMatchBech32 matches any address encoding the same account,
+	// regardless of the bech32 prefix
+	SkiplistMatchBech32 = "bech32"
+)
+
+// SkiplistEntry excludes an address from the leaderboard and the
+// "excluding" stats while ValidFrom <= block date < ValidUntil. Removed
+// entries are kept, with DeletedAt set, for the exclusions that refer to
+// them, and only one entry per address can be active
+type SkiplistEntry struct {
+	ID          uint64         `gorm:"primary_key" json:"id"`
+	Address     string         `gorm:"column:address;uniqueIndex:idx_skiplist_active_address,where:deleted_at IS NULL" json:"address"`
+	Match       string         `gorm:"column:match" json:"match"`
+	Category    string         `gorm:"column:category" json:"category"`
+	Reason      string         `gorm:"column:reason" json:"reason"`
+	ValidFrom   *time.Time     `gorm:"column:valid_from" json:"valid_from,omitempty"`
+	ValidUntil  *time.Time     `gorm:"column:valid_until" json:"valid_until,omitempty"`
+	DateCreated time.Time      `gorm:"column:date_created" json:"date_created"`
+	DeletedAt   gorm.DeletedAt `gorm:"column:deleted_at;index" json:"removed_at"`
+}
+
+func (SkiplistEntry) TableName() string {
+	return "skiplist"
+}
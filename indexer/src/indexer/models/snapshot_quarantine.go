@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+)
+
+// SnapshotQuarantine is a snapshot held back from the leaderboard because it
+// failed the anomaly guards. An approved snapshot is captured on the next
+// pass without being checked again, and published unless a newer snapshot
+// was captured meanwhile
+type SnapshotQuarantine struct {
+	ID             uint64     `gorm:"primary_key" json:"-"`
+	Height         int64      `gorm:"column:height;uniqueIndex" json:"height"`
+	Reasons        string     `gorm:"column:reasons" json:"reasons"`
+	TotalDroplets  int64      `gorm:"column:total_droplets" json:"total_droplets"`
+	TotalAddresses int64      `gorm:"column:total_addresses" json:"total_addresses"`
+	TotalAtom      uint64     `gorm:"column:total_atom" json:"total_atom"`
+	Approved       bool       `gorm:"column:approved" json:"approved"`
+	DateBlock      time.Time  `gorm:"column:date_block" json:"date_block"`
+	DateCreated    time.Time  `gorm:"column:date_created" json:"date_created"`
+	DateApproved   *time.Time `gorm:"column:date_approved" json:"date_approved,omitempty"`
+}
+
+func (SnapshotQuarantine) TableName() string {
+	return "snapshot_quarantine"
+}
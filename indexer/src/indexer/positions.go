@@ -0,0 +1,151 @@
+package indexer
+
+import (
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// PositionAssumptions are the assumptions the dATOM position estimate is
+// based on. They are served along with every estimate
+var PositionAssumptions = []string{
+	"Droplets accrue in proportion to the dATOM-related position held, at the same rate for every address",
+	"The position of an address is constant between two consecutive snapshots",
+	"Protocol-wide dATOM is the average of the Drop staked ATOM totals at both snapshots",
+	"Every dATOM-related position in the protocol earns Droplets, so the shares of accrual sum to one",
+	"Droplets granted outside of regular accrual (bonuses, campaigns) are indistinguishable from accrual",
+}
+
+// updatePositions estimates the dATOM-equivalent position of every address
+// from the Droplets accrued since the previous snapshot
+func (i *Indexer) updatePositions(height int64, dateBlock time.Time) error {
+	previousHeight, err := i.previousHeight(height)
+	if err != nil {
+		return err
+	}
+	if previousHeight == 0 {
+		// Nothing to compare the first snapshot to
+		return nil
+	}
+
+	var previousStats models.DropletStatsHistory
+	result := i.db.Where("height = ?", previousHeight).First(&previousStats)
+	if result.Error != nil {
+		return result.Error
+	}
+	days := dateBlock.Sub(previousStats.DateBlock).Hours() / 24
+	if days <= 0 {
+		return nil
+	}
+
+	current, err := i.balancesAtHeight(height)
+	if err != nil {
+		return err
+	}
+	previous, err := i.balancesAtHeight(previousHeight)
+	if err != nil {
+		return err
+	}
+
+	totalAtom, err := i.averageDropAtom(previousHeight, height)
+	if err != nil {
+		return err
+	}
+
+	// Rates of the previous interval to detect sharp changes
+	var previousPositions []models.DropletAddressPosition
+	result = i.db.Select("address, rate_per_day").
+		Where("height = ?", previousHeight).
+		Find(&previousPositions)
+	if result.Error != nil {
+		return result.Error
+	}
+	previousRates := make(map[string]float64, len(previousPositions))
+	for _, position := range previousPositions {
+		previousRates[position.Address] = position.RatePerDay
+	}
+
+	var totalDelta int64
+	deltas := make(map[string]int64, len(current))
+	for address, droplets := range current {
+		delta := int64(droplets) - int64(previous[address])
+		deltas[address] = delta
+		if delta > 0 {
+			totalDelta += delta
+		}
+	}
+
+	positions := make([]models.DropletAddressPosition, 0, len(deltas))
+	for address, delta := range deltas {
+		position := models.DropletAddressPosition{
+			Address:        address,
+			Height:         height,
+			PreviousHeight: previousHeight,
+			DropletDelta:   delta,
+			RatePerDay:     float64(delta) / days,
+			DateBlock:      dateBlock,
+			DateCreated:    time.Now(),
+		}
+		if delta > 0 && totalDelta > 0 {
+			position.ProgramShare = float64(delta) / float64(totalDelta)
+			position.ImpliedAtom = position.ProgramShare * totalAtom
+		}
+		if previousRate, ok := previousRates[address]; ok && previousRate > 0 {
+			position.RateChange = position.RatePerDay / previousRate
+			position.Flagged = position.RateChange >= i.positionRateChangeThreshold ||
+				position.RateChange <= 1/i.positionRateChangeThreshold
+		}
+		positions = append(positions, position)
+	}
+
+	// Replace the estimates of the snapshot in one transaction, so a failure
+	// doesn't leave it without any
+	err = i.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("height = ?", height).Delete(&models.DropletAddressPosition{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if len(positions) > 0 {
+			result = tx.CreateInBatches(positions, 1000)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"count":      len(positions),
+		"total_atom": totalAtom,
+	}).Debug("Positions updated")
+
+	return nil
+}
+
+// averageDropAtom returns the average Drop staked ATOM over the snapshots at
+// the given heights, skipping any height without a stored total
+func (i *Indexer) averageDropAtom(heights ...int64) (float64, error) {
+	var total float64
+	var count int
+	for _, height := range heights {
+		var history models.DropAtomHistory
+		result := i.db.Where("height = ?", height).First(&history)
+		if result.Error != nil {
+			if result.Error == gorm.ErrRecordNotFound {
+				continue
+			}
+			return 0, result.Error
+		}
+		total += float64(history.TotalAtom)
+		count++
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	return total / float64(count), nil
+}
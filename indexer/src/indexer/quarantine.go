@@ -0,0 +1,29 @@
+package indexer
+
+import (
+	"encoding/hex"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"gorm.io/gorm/clause"
+)
+
+// storeQuarantinedKeys stores the contract state entries that failed
+// validation at height with their raw hex key and value
+func (i *Indexer) storeQuarantinedKeys(height int64, quarantined []QuarantinedKey) error {
+	if len(quarantined) == 0 {
+		return nil
+	}
+
+	rows := make([]models.DropletKeyQuarantine, 0, len(quarantined))
+	for _, key := range quarantined {
+		rows = append(rows, models.DropletKeyQuarantine{
+			Height:      height,
+			RawKey:      hex.EncodeToString(key.Key),
+			RawValue:    hex.EncodeToString(key.Value),
+			Reason:      key.Reason,
+			DateCreated: time.Now(),
+		})
+	}
+	return i.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+}
@@ -152,3 +152,89 @@ func (m *PageResponse) GetTotal() uint64 {
 	}
 	return 0
 }
+
+// QueryContractInfoRequest is the request type for the Query/ContractInfo RPC
+// method
+type QueryContractInfoRequest struct {
+	// address is the address of the contract to query
+	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+}
+
+func (m *QueryContractInfoRequest) Reset()         { *m = QueryContractInfoRequest{} }
+func (m *QueryContractInfoRequest) String() string { return proto.CompactTextString(m) }
+func (*QueryContractInfoRequest) ProtoMessage()    {}
+
+// QueryContractInfoResponse is the response type for the Query/ContractInfo
+// RPC method
+type QueryContractInfoResponse struct {
+	// address is the address of the contract
+	Address      string       `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	ContractInfo ContractInfo `protobuf:"bytes,2,opt,name=contract_info,json=contractInfo,proto3" json:"contract_info"`
+}
+
+func (m *QueryContractInfoResponse) Reset()         { *m = QueryContractInfoResponse{} }
+func (m *QueryContractInfoResponse) String() string { return proto.CompactTextString(m) }
+func (*QueryContractInfoResponse) ProtoMessage()    {}
+
+// ContractInfo stores a WASM contract instance
+type ContractInfo struct {
+	// CodeID is the reference to the stored Wasm code
+	CodeID uint64 `protobuf:"varint,1,opt,name=code_id,json=codeId,proto3" json:"code_id,omitempty"`
+	// Creator address who initially instantiated the contract
+	Creator string `protobuf:"bytes,2,opt,name=creator,proto3" json:"creator,omitempty"`
+	// Admin is an optional address that can execute migrations
+	Admin string `protobuf:"bytes,3,opt,name=admin,proto3" json:"admin,omitempty"`
+	// Label is optional metadata to be stored with a contract instance.
+	Label string `protobuf:"bytes,4,opt,name=label,proto3" json:"label,omitempty"`
+}
+
+func (m *ContractInfo) Reset()         { *m = ContractInfo{} }
+func (m *ContractInfo) String() string { return proto.CompactTextString(m) }
+func (*ContractInfo) ProtoMessage()    {}
+
+// QuerySmartContractStateRequest is the request type for the
+// Query/SmartContractState RPC method
+type QuerySmartContractStateRequest struct {
+	// address is the address of the contract
+	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	// QueryData contains the query data passed to the contract
+	QueryData []byte `protobuf:"bytes,2,opt,name=query_data,json=queryData,proto3" json:"query_data,omitempty"`
+}
+
+func (m *QuerySmartContractStateRequest) Reset()         { *m = QuerySmartContractStateRequest{} }
+func (m *QuerySmartContractStateRequest) String() string { return proto.CompactTextString(m) }
+func (*QuerySmartContractStateRequest) ProtoMessage()    {}
+
+// QuerySmartContractStateResponse is the response type for the
+// Query/SmartContractState RPC method
+type QuerySmartContractStateResponse struct {
+	// Data contains the json data returned from the smart contract
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *QuerySmartContractStateResponse) Reset()         { *m = QuerySmartContractStateResponse{} }
+func (m *QuerySmartContractStateResponse) String() string { return proto.CompactTextString(m) }
+func (*QuerySmartContractStateResponse) ProtoMessage()    {}
+
+// QueryRawContractStateRequest is the request type for the
+// Query/RawContractState RPC method
+type QueryRawContractStateRequest struct {
+	// address is the address of the contract
+	Address   string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	QueryData []byte `protobuf:"bytes,2,opt,name=query_data,json=queryData,proto3" json:"query_data,omitempty"`
+}
+
+func (m *QueryRawContractStateRequest) Reset()         { *m = QueryRawContractStateRequest{} }
+func (m *QueryRawContractStateRequest) String() string { return proto.CompactTextString(m) }
+func (*QueryRawContractStateRequest) ProtoMessage()    {}
+
+// QueryRawContractStateResponse is the response type for the
+// Query/RawContractState RPC method
+type QueryRawContractStateResponse struct {
+	// Data contains the raw store data
+	Data []byte `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (m *QueryRawContractStateResponse) Reset()         { *m = QueryRawContractStateResponse{} }
+func (m *QueryRawContractStateResponse) String() string { return proto.CompactTextString(m) }
+func (*QueryRawContractStateResponse) ProtoMessage()    {}
@@ -0,0 +1,189 @@
+package indexer
+
+import (
+	"math"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// RateWindows are the rolling windows, in days, over which earning rates
+// are fitted for every address
+var RateWindows = []int{7, 30}
+
+// tCritical95 holds the two-sided 95% critical values of Student's
+// t-distribution indexed by degrees of freedom. Anything above the table
+// uses the normal approximation
+var tCritical95 = []float64{
+	0, 12.706, 4.303, 3.182, 2.776, 2.571, 2.447, 2.365, 2.306, 2.262, 2.228,
+	2.201, 2.179, 2.160, 2.145, 2.131, 2.120, 2.110, 2.101, 2.093, 2.086,
+	2.080, 2.074, 2.069, 2.064, 2.060, 2.056, 2.052, 2.048, 2.045, 2.042,
+}
+
+// rateSample is a single point of an address' balance history
+type rateSample struct {
+	days     float64
+	droplets uint64
+}
+
+// EarningRate is the result of fitting a line through the balance history
+// of an address. Rates are in Droplets per day. The bounds are nil when
+// there are too few samples to estimate them
+type EarningRate struct {
+	Rate      float64
+	RateLower *float64
+	RateUpper *float64
+	Samples   int
+}
+
+// fitEarningRate fits a least squares line through the samples and returns
+// the slope with its 95% confidence interval. Droplets are never removed so
+// the lower bound is clamped at zero. Up to two samples give no interval
+func fitEarningRate(samples []rateSample) EarningRate {
+	n := len(samples)
+	if n < 2 {
+		return EarningRate{Samples: n}
+	}
+
+	var meanX, meanY float64
+	for _, s := range samples {
+		meanX += s.days
+		meanY += float64(s.droplets)
+	}
+	meanX /= float64(n)
+	meanY /= float64(n)
+
+	var sxx, sxy float64
+	for _, s := range samples {
+		dx := s.days - meanX
+		sxx += dx * dx
+		sxy += dx * (float64(s.droplets) - meanY)
+	}
+	if sxx == 0 {
+		// All samples at the same time, nothing to fit
+		return EarningRate{Samples: n}
+	}
+	slope := sxy / sxx
+
+	// With only two points the line is exact and there is no residual to
+	// estimate the error from, the interval is unknown rather than empty
+	if n == 2 {
+		return EarningRate{
+			Rate:    slope,
+			Samples: n,
+		}
+	}
+
+	var sse float64
+	intercept := meanY - slope*meanX
+	for _, s := range samples {
+		residual := float64(s.droplets) - (intercept + slope*s.days)
+		sse += residual * residual
+	}
+	degrees := n - 2
+	standardError := math.Sqrt(sse / float64(degrees) / sxx)
+	critical := 1.96
+	if degrees < len(tCritical95) {
+		critical = tCritical95[degrees]
+	}
+
+	lower := math.Max(0, slope-critical*standardError)
+	upper := slope + critical*standardError
+	return EarningRate{
+		Rate:      slope,
+		RateLower: &lower,
+		RateUpper: &upper,
+		Samples:   n,
+	}
+}
+
+// updateEarningRates refits the earning rate of every address for each of
+// the RateWindows, ending at the snapshot for height
+func (i *Indexer) updateEarningRates(height int64, dateBlock time.Time) error {
+	for _, windowDays := range RateWindows {
+		since := dateBlock.Add(-time.Hour * 24 * time.Duration(windowDays))
+
+		rows, err := i.db.Model(&models.DropletAddressHistory{}).
+			Select("address, droplets, date_block, height").
+			Where("date_block >= ? AND height <= ? AND excluded = ?", since, height, false).
+			Order("address, height").
+			Rows()
+		if err != nil {
+			return err
+		}
+
+		var rates []models.DropletAddressRate
+		var address string
+		var samples []rateSample
+		var latest models.DropletAddressHistory
+
+		// flush stores the fit for the address we've collected samples for.
+		// Addresses that are no longer in the latest snapshot are dropped
+		flush := func() {
+			if address == "" || latest.Height != height {
+				return
+			}
+			fit := fitEarningRate(samples)
+			rates = append(rates, models.DropletAddressRate{
+				Address:     address,
+				WindowDays:  windowDays,
+				Rate:        fit.Rate,
+				RateLower:   fit.RateLower,
+				RateUpper:   fit.RateUpper,
+				Samples:     fit.Samples,
+				Droplets:    latest.Droplets,
+				Height:      height,
+				DateBlock:   dateBlock,
+				DateCreated: time.Now(),
+			})
+		}
+
+		for rows.Next() {
+			var item models.DropletAddressHistory
+			err = i.db.ScanRows(rows, &item)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if item.Address != address {
+				flush()
+				address = item.Address
+				samples = samples[:0]
+			}
+			samples = append(samples, rateSample{
+				days:     item.DateBlock.Sub(since).Hours() / 24,
+				droplets: item.Droplets,
+			})
+			latest = item
+		}
+		flush()
+		rows.Close()
+
+		// Replace the previous fits for this window in one transaction, so
+		// a failure doesn't leave the window without any
+		err = i.db.Transaction(func(tx *gorm.DB) error {
+			result := tx.Where("window_days = ?", windowDays).Delete(&models.DropletAddressRate{})
+			if result.Error != nil {
+				return result.Error
+			}
+			if len(rates) > 0 {
+				result = tx.CreateInBatches(rates, 1000)
+				if result.Error != nil {
+					return result.Error
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		i.logger.WithFields(logrus.Fields{
+			"window_days": windowDays,
+			"count":       len(rates),
+		}).Debug("Earning rates updated")
+	}
+	return nil
+}
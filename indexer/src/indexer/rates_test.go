@@ -0,0 +1,65 @@
+package indexer
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFitEarningRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []rateSample
+		rate    float64
+		bounded bool
+	}{
+		{"no samples", nil, 0, false},
+		{"one sample", []rateSample{{0, 100}}, 0, false},
+		{"same time", []rateSample{{1, 100}, {1, 200}, {1, 300}}, 0, false},
+		{"two samples", []rateSample{{0, 100}, {2, 300}}, 100, false},
+		{"exact line", []rateSample{{0, 100}, {1, 150}, {2, 200}, {3, 250}}, 50, true},
+		{"noisy line", []rateSample{{0, 0}, {1, 110}, {2, 190}, {3, 310}, {4, 390}}, 98, true},
+		{"flat", []rateSample{{0, 500}, {1, 500}, {2, 500}}, 0, true},
+	}
+	for _, test := range tests {
+		fit := fitEarningRate(test.samples)
+		if fit.Samples != len(test.samples) {
+			t.Errorf("%s: samples %d, want %d", test.name, fit.Samples, len(test.samples))
+		}
+		if math.Abs(fit.Rate-test.rate) > 1e-9 {
+			t.Errorf("%s: rate %v, want %v", test.name, fit.Rate, test.rate)
+		}
+		if (fit.RateLower != nil) != test.bounded || (fit.RateUpper != nil) != test.bounded {
+			t.Errorf("%s: bounds %v, %v, want bounded %v", test.name, fit.RateLower, fit.RateUpper, test.bounded)
+			continue
+		}
+		if !test.bounded {
+			continue
+		}
+		if *fit.RateLower < 0 || *fit.RateLower > fit.Rate || *fit.RateUpper < fit.Rate {
+			t.Errorf("%s: interval %v to %v doesn't hold the rate %v", test.name, *fit.RateLower, *fit.RateUpper, fit.Rate)
+		}
+	}
+}
+
+func TestFitEarningRateInterval(t *testing.T) {
+	// An exact line has no residual, the interval is the rate itself
+	fit := fitEarningRate([]rateSample{{0, 100}, {1, 150}, {2, 200}})
+	if *fit.RateLower != 50 || *fit.RateUpper != 50 {
+		t.Errorf("exact line interval %v to %v, want 50 to 50", *fit.RateLower, *fit.RateUpper)
+	}
+
+	// The interval narrows as samples are added to the same noisy line
+	noisy := []rateSample{{0, 0}, {1, 120}, {2, 180}, {3, 320}, {4, 380}, {5, 520}, {6, 580}, {7, 720}}
+	few := fitEarningRate(noisy[:4])
+	many := fitEarningRate(noisy)
+	if *many.RateUpper-*many.RateLower >= *few.RateUpper-*few.RateLower {
+		t.Errorf("interval of %d samples %v wide, of %d samples %v wide",
+			many.Samples, *many.RateUpper-*many.RateLower, few.Samples, *few.RateUpper-*few.RateLower)
+	}
+
+	// A falling balance is clamped at zero
+	falling := fitEarningRate([]rateSample{{0, 300}, {1, 210}, {2, 90}})
+	if *falling.RateLower != 0 {
+		t.Errorf("falling lower bound %v, want 0", *falling.RateLower)
+	}
+}
@@ -0,0 +1,64 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// Version of the indexer binary, set at build time with
+// -ldflags "-X github.com/donovansolms/droplets-dashboard/indexer/src/indexer.Version=..."
+var Version = "dev"
+
+// startRun records the start of a pass in the run ledger
+func (i *Indexer) startRun() *models.IndexerRun {
+	run := &models.IndexerRun{
+		Outcome:     models.IndexerRunRunning,
+		RPCEndpoint: i.rpcEndpoint,
+		Version:     Version,
+		DateStarted: time.Now(),
+	}
+	result := i.db.Create(run)
+	if result.Error != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to record run")
+	}
+	return run
+}
+
+// finishRun records the outcome of a pass in the run ledger. A pass without
+// an outcome that returned an error failed
+func (i *Indexer) finishRun(run *models.IndexerRun, err error) {
+	finished := time.Now()
+	run.DateFinished = &finished
+	if err != nil {
+		run.Outcome = models.IndexerRunFailed
+		if errors.Is(err, context.Canceled) {
+			run.Outcome = models.IndexerRunStopped
+		}
+		run.Error = err.Error()
+	}
+	if run.Outcome == models.IndexerRunRunning {
+		run.Outcome = models.IndexerRunSkipped
+	}
+
+	passDuration.WithLabelValues(run.Outcome).Observe(finished.Sub(run.DateStarted).Seconds())
+
+	result := i.db.Save(run)
+	if result.Error != nil {
+		i.logger.WithFields(logrus.Fields{
+			"err": result.Error,
+		}).Error("Unable to record run")
+		return
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"outcome":  run.Outcome,
+		"height":   run.Height,
+		"duration": finished.Sub(run.DateStarted),
+	}).Info("Run recorded")
+}
@@ -0,0 +1,159 @@
+package indexer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cosmos/btcutil/bech32"
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// SkiplistCategories are the categories a skiplist entry can have
+var SkiplistCategories = []string{"contract", "team", "exchange", "other"}
+
+// Skiplist matches addresses against the skiplist entries
+type Skiplist struct {
+	entries []skiplistMatcher
+}
+
+// skiplistMatcher is an entry with its decoded account bytes for bech32
+// matching
+type skiplistMatcher struct {
+	entry   models.SkiplistEntry
+	account []byte
+}
+
+// NewSkiplist returns a Skiplist for the entries, which must be valid
+func NewSkiplist(entries []models.SkiplistEntry) *Skiplist {
+	skiplist := &Skiplist{}
+	for _, entry := range entries {
+		matcher := skiplistMatcher{entry: entry}
+		if entry.Match == models.SkiplistMatchBech32 {
+			_, matcher.account, _ = bech32.DecodeToBase256(entry.Address)
+		}
+		skiplist.entries = append(skiplist.entries, matcher)
+	}
+	return skiplist
+}
+
+// Match returns the entry excluding address at the given block date
+func (s *Skiplist) Match(address string, at time.Time) (models.SkiplistEntry, bool) {
+	address = strings.ToLower(address)
+	var account []byte
+	decoded := false
+	for _, matcher := range s.entries {
+		entry := matcher.entry
+		if entry.ValidFrom != nil && at.Before(*entry.ValidFrom) {
+			continue
+		}
+		if entry.ValidUntil != nil && !at.Before(*entry.ValidUntil) {
+			continue
+		}
+
+		if entry.Address == address {
+			return entry, true
+		}
+		if matcher.account == nil {
+			continue
+		}
+		if !decoded {
+			_, account, _ = bech32.DecodeToBase256(address)
+			decoded = true
+		}
+		if account != nil && bytes.Equal(account, matcher.account) {
+			return entry, true
+		}
+	}
+	return models.SkiplistEntry{}, false
+}
+
+// ValidateSkiplistEntry checks and normalises entry, defaulting to an exact
+// match in the "other" category
+func ValidateSkiplistEntry(entry *models.SkiplistEntry) error {
+	entry.Address = strings.ToLower(strings.TrimSpace(entry.Address))
+	if entry.Address == "" {
+		return fmt.Errorf("address is required")
+	}
+
+	if entry.Match == "" {
+		entry.Match = models.SkiplistMatchExact
+	}
+	switch entry.Match {
+	case models.SkiplistMatchExact:
+	case models.SkiplistMatchBech32:
+		_, _, err := bech32.DecodeToBase256(entry.Address)
+		if err != nil {
+			return fmt.Errorf("address is not a valid bech32 address: %v", err)
+		}
+	default:
+		return fmt.Errorf("match must be %s or %s", models.SkiplistMatchExact, models.SkiplistMatchBech32)
+	}
+
+	if entry.Category == "" {
+		entry.Category = "other"
+	}
+	if !containsString(SkiplistCategories, entry.Category) {
+		return fmt.Errorf("category must be one of %s", strings.Join(SkiplistCategories, ", "))
+	}
+
+	if entry.ValidFrom != nil && entry.ValidUntil != nil && !entry.ValidUntil.After(*entry.ValidFrom) {
+		return fmt.Errorf("valid_until must be after valid_from")
+	}
+	return nil
+}
+
+// seedSkiplist adds the addresses from the SKIPLIST environment variable that
+// aren't managed yet as exact entries. It runs once at startup, and entries
+// removed through the API aren't added again
+func (i *Indexer) seedSkiplist() error {
+	for _, address := range i.skipList {
+		entry := models.SkiplistEntry{
+			Address:     address,
+			Match:       models.SkiplistMatchExact,
+			Category:    "other",
+			Reason:      "SKIPLIST environment variable",
+			DateCreated: time.Now(),
+		}
+		err := ValidateSkiplistEntry(&entry)
+		if err != nil {
+			return fmt.Errorf("invalid SKIPLIST address %q: %v", address, err)
+		}
+		// Earlier versions matched SKIPLIST values as substrings, a partial
+		// address now excludes nothing
+		_, _, err = bech32.DecodeToBase256(entry.Address)
+		if err != nil {
+			i.logger.WithFields(logrus.Fields{
+				"address": entry.Address,
+				"err":     err,
+			}).Warn("SKIPLIST value is not a full bech32 address and only matches an identical address")
+		}
+
+		var existing models.SkiplistEntry
+		result := i.db.Unscoped().Where("address = ?", entry.Address).First(&existing)
+		if result.Error == nil {
+			continue
+		}
+		if result.Error != gorm.ErrRecordNotFound {
+			return result.Error
+		}
+		result = i.db.Create(&entry)
+		if result.Error != nil {
+			return result.Error
+		}
+	}
+	return nil
+}
+
+// loadSkiplist returns the skiplist from the managed entries
+func (i *Indexer) loadSkiplist() (*Skiplist, error) {
+	var entries []models.SkiplistEntry
+	result := i.db.Find(&entries)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return NewSkiplist(entries), nil
+}
@@ -0,0 +1,101 @@
+package indexer
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cosmos/btcutil/bech32"
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+)
+
+// testAddress returns the bech32 address of account with the prefix
+func testAddress(t *testing.T, prefix string, account []byte) string {
+	t.Helper()
+	address, err := bech32.EncodeFromBase256(prefix, account)
+	if err != nil {
+		t.Fatalf("unable to encode %s address: %v", prefix, err)
+	}
+	return address
+}
+
+func TestSkiplistMatch(t *testing.T) {
+	account := bytes.Repeat([]byte{1}, accountLength)
+	other := bytes.Repeat([]byte{2}, accountLength)
+	neutron := testAddress(t, NeutronPrefix, account)
+	cosmos := testAddress(t, "cosmos", account)
+	otherNeutron := testAddress(t, NeutronPrefix, other)
+	windowed := testAddress(t, NeutronPrefix, bytes.Repeat([]byte{3}, accountLength))
+
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	skiplist := NewSkiplist([]models.SkiplistEntry{
+		{Address: cosmos, Match: models.SkiplistMatchBech32, Reason: "bech32"},
+		{Address: "neutron1partial", Match: models.SkiplistMatchExact, Reason: "exact"},
+		{Address: windowed, Match: models.SkiplistMatchExact, Reason: "window", ValidFrom: &from, ValidUntil: &until},
+	})
+
+	inside := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		address string
+		at      time.Time
+		reason  string
+		match   bool
+	}{
+		{neutron, inside, "bech32", true},
+		{cosmos, inside, "bech32", true},
+		{otherNeutron, inside, "", false},
+		{"neutron1partial", inside, "exact", true},
+		{"NEUTRON1PARTIAL", inside, "exact", true},
+		{"neutron1part", inside, "", false},
+		{"neutron1partialx", inside, "", false},
+		{windowed, inside, "window", true},
+		{windowed, from, "window", true},
+		{windowed, from.Add(-time.Second), "", false},
+		{windowed, until, "", false},
+	}
+	for _, test := range tests {
+		entry, match := skiplist.Match(test.address, test.at)
+		if match != test.match || entry.Reason != test.reason {
+			t.Errorf("Match(%s, %s) = %q, %v, want %q, %v",
+				test.address, test.at.Format(time.RFC3339), entry.Reason, match, test.reason, test.match)
+		}
+	}
+}
+
+func TestValidateSkiplistEntry(t *testing.T) {
+	address := testAddress(t, NeutronPrefix, bytes.Repeat([]byte{1}, accountLength))
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	before := from.Add(-time.Hour)
+	tests := []struct {
+		name     string
+		entry    models.SkiplistEntry
+		match    string
+		category string
+		valid    bool
+	}{
+		{"defaults", models.SkiplistEntry{Address: " " + address + " "}, models.SkiplistMatchExact, "other", true},
+		{"bech32", models.SkiplistEntry{Address: address, Match: models.SkiplistMatchBech32, Category: "team"}, models.SkiplistMatchBech32, "team", true},
+		{"missing address", models.SkiplistEntry{Address: "  "}, "", "", false},
+		{"invalid bech32", models.SkiplistEntry{Address: "neutron1partial", Match: models.SkiplistMatchBech32}, "", "", false},
+		{"unknown match", models.SkiplistEntry{Address: address, Match: "prefix"}, "", "", false},
+		{"unknown category", models.SkiplistEntry{Address: address, Category: "whale"}, "", "", false},
+		{"empty window", models.SkiplistEntry{Address: address, ValidFrom: &from, ValidUntil: &from}, "", "", false},
+		{"inverted window", models.SkiplistEntry{Address: address, ValidFrom: &from, ValidUntil: &before}, "", "", false},
+	}
+	for _, test := range tests {
+		entry := test.entry
+		err := ValidateSkiplistEntry(&entry)
+		if (err == nil) != test.valid {
+			t.Errorf("%s: ValidateSkiplistEntry error %v, want valid %v", test.name, err, test.valid)
+			continue
+		}
+		if !test.valid {
+			continue
+		}
+		if entry.Address != address || entry.Match != test.match || entry.Category != test.category {
+			t.Errorf("%s: ValidateSkiplistEntry normalised to %s %s %s, want %s %s %s",
+				test.name, entry.Address, entry.Match, entry.Category, address, test.match, test.category)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package indexer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Transports a smart query is sent over
+const (
+	// TransportRPC queries the contract over ABCI through RPC_ENDPOINT
+	TransportRPC = "rpc"
+	// TransportLCD queries the contract through the REST API at LCD_ENDPOINT
+	TransportLCD = "lcd"
+)
+
+// SmartQuery is a CosmWasm smart query with the JSON path of the value read
+// from its response
+type SmartQuery struct {
+	// Contract is the address of the queried contract
+	Contract string
+	// Message is the plain JSON query message, ie. {"total_bonded":{}}
+	Message string
+	// Path is the JSON path of the value in the response, ie. $.amount or
+	// $.items[0].amount. The root, $, is the whole response
+	Path string
+}
+
+// parseDropAtomQuery returns the dATOM query of DROP_CORE_CONTRACT_ADDRESS
+// and DROP_ATOM_QUERY. A query given as a REST URL, the form used before
+// messages, has its contract and message taken from the URL, and legacy is
+// set
+func parseDropAtomQuery(contract string, query string) (SmartQuery, bool, error) {
+	if !strings.HasPrefix(query, "http://") && !strings.HasPrefix(query, "https://") {
+		if contract == "" {
+			return SmartQuery{}, false, errors.New("DROP_CORE_CONTRACT_ADDRESS is required")
+		}
+		return SmartQuery{Contract: contract, Message: query}, false, nil
+	}
+
+	legacy, err := parseSmartQueryURL(query)
+	if err != nil {
+		return SmartQuery{}, true, fmt.Errorf("DROP_ATOM_QUERY is a URL but not a smart query: %v. "+
+			"Set DROP_CORE_CONTRACT_ADDRESS and DROP_ATOM_QUERY to the JSON message, ie. {\"total_bonded\":{}}", err)
+	}
+	if contract != "" && contract != legacy.Contract {
+		return SmartQuery{}, true, fmt.Errorf("DROP_ATOM_QUERY queries %s but DROP_CORE_CONTRACT_ADDRESS is %s",
+			legacy.Contract, contract)
+	}
+	return legacy, true, nil
+}
+
+// parseSmartQueryURL returns the contract and message of a REST smart query
+// URL, {lcd}/cosmwasm/wasm/v1/contract/{contract}/smart/{base64 message}
+func parseSmartQueryURL(value string) (SmartQuery, error) {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return SmartQuery{}, err
+	}
+	segments := strings.Split(strings.Trim(parsed.Path, "/"), "/")
+	for n := 0; n+3 < len(segments); n++ {
+		if segments[n] != "contract" || segments[n+2] != "smart" {
+			continue
+		}
+		encoded, err := url.PathUnescape(segments[n+3])
+		if err != nil {
+			return SmartQuery{}, err
+		}
+		message, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			message, err = base64.URLEncoding.DecodeString(encoded)
+		}
+		if err != nil {
+			return SmartQuery{}, fmt.Errorf("the message isn't base64: %v", err)
+		}
+		var object map[string]json.RawMessage
+		if json.Unmarshal(message, &object) != nil {
+			return SmartQuery{}, fmt.Errorf("the message %q isn't a JSON object", message)
+		}
+		return SmartQuery{Contract: segments[n+1], Message: string(message)}, nil
+	}
+	return SmartQuery{}, errors.New("no /contract/{address}/smart/{message} in its path")
+}
+
+// smartQuery runs query at height over the configured transport and returns
+// the value at the query's path
+func (i *Indexer) smartQuery(ctx context.Context, op string, query SmartQuery, height int64) (any, error) {
+	var data []byte
+	var err error
+	switch i.queryTransport {
+	case TransportLCD:
+		data, err = i.lcdSmartQuery(ctx, op, query, height)
+	default:
+		var response QuerySmartContractStateResponse
+		err = i.abciQuery(
+			ctx,
+			"/cosmwasm.wasm.v1.Query/SmartContractState",
+			&QuerySmartContractStateRequest{
+				Address:   query.Contract,
+				QueryData: []byte(query.Message),
+			},
+			height,
+			&response,
+		)
+		data = response.Data
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := jsonPath(data, query.Path)
+	if err != nil {
+		return nil, dataError(op, err)
+	}
+	return value, nil
+}
+
+// lcdSmartQuery runs query at height through the REST API and returns the
+// contract's response
+func (i *Indexer) lcdSmartQuery(ctx context.Context, op string, query SmartQuery, height int64) ([]byte, error) {
+	// The REST API takes the message base64 encoded in the path
+	endpoint := fmt.Sprintf("%s/cosmwasm/wasm/v1/contract/%s/smart/%s",
+		strings.TrimSuffix(i.lcdEndpoint, "/"),
+		url.PathEscape(query.Contract),
+		url.PathEscape(base64.StdEncoding.EncodeToString([]byte(query.Message))),
+	)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, permanentError(op, fmt.Errorf("failed to create HTTP request: %v", err))
+	}
+	req.Header.Set("x-cosmos-block-height", fmt.Sprintf("%d", height))
+	req.Header.Set("User-Agent", "DropletDashboard-Indexer")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, requestError(op, fmt.Errorf("failed to execute HTTP request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(op, resp)
+	}
+
+	// The contract's response is wrapped in data
+	var result struct {
+		Data json.RawMessage `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&result)
+	if err != nil {
+		return nil, dataError(op, fmt.Errorf("failed to parse response body: %v", err))
+	}
+	if result.Data == nil {
+		return nil, dataError(op, errors.New("missing 'data' field in response"))
+	}
+	return result.Data, nil
+}
+
+// parsePath splits a JSON path into its object keys and array indexes. Both
+// $.items[0].amount and items.0.amount are accepted
+func parsePath(path string) ([]string, error) {
+	path = strings.TrimSpace(path)
+	path = strings.TrimPrefix(path, "$")
+	path = strings.ReplaceAll(path, "[", ".")
+	path = strings.ReplaceAll(path, "]", "")
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return nil, nil
+	}
+
+	segments := strings.Split(path, ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return nil, errors.New("empty segment in JSON path")
+		}
+	}
+	return segments, nil
+}
+
+// jsonPath returns the value at path in data. Numbers are kept as
+// json.Number so large amounts don't lose precision
+func jsonPath(data []byte, path string) (any, error) {
+	segments, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value any
+	err = decoder.Decode(&value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse response: %v", err)
+	}
+
+	for n, segment := range segments {
+		switch current := value.(type) {
+		case map[string]any:
+			field, ok := current[segment]
+			if !ok {
+				return nil, fmt.Errorf("missing '%s' in response", strings.Join(segments[:n+1], "."))
+			}
+			value = field
+		case []any:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil, fmt.Errorf("no index %s in response at '%s'", segment, strings.Join(segments[:n], "."))
+			}
+			value = current[index]
+		default:
+			return nil, fmt.Errorf("'%s' in response is not an object or array", strings.Join(segments[:n], "."))
+		}
+	}
+	return value, nil
+}
+
+// uint64Value converts a value read from a query response to an amount.
+// Contracts return amounts as strings, numbers are accepted too
+func uint64Value(value any) (uint64, error) {
+	switch value := value.(type) {
+	case string:
+		return strconv.ParseUint(value, 10, 64)
+	case json.Number:
+		return strconv.ParseUint(value.String(), 10, 64)
+	default:
+		return 0, fmt.Errorf("expected an amount, got %T", value)
+	}
+}
@@ -0,0 +1,128 @@
+package indexer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path     string
+		segments []string
+		ok       bool
+	}{
+		{"", nil, true},
+		{"$", nil, true},
+		{" $ ", nil, true},
+		{"$.amount", []string{"amount"}, true},
+		{"amount", []string{"amount"}, true},
+		{"$.items[0].amount", []string{"items", "0", "amount"}, true},
+		{"$[1]", []string{"1"}, true},
+		{"$.a..b", nil, false},
+		{"$.a.", nil, false},
+		{"$.a[]", nil, false},
+	}
+	for _, test := range tests {
+		segments, err := parsePath(test.path)
+		if (err == nil) != test.ok || !reflect.DeepEqual(segments, test.segments) {
+			t.Errorf("parsePath(%q) = %q, %v, want %q, ok %v", test.path, segments, err, test.segments, test.ok)
+		}
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	response := []byte(`{"amount":"12","nested":{"value":34},"items":[{"amount":"5"},{"amount":"6"}],"empty":null}`)
+	tests := []struct {
+		path  string
+		value any
+		ok    bool
+	}{
+		{"$.amount", "12", true},
+		{"$.nested.value", json.Number("34"), true},
+		{"$.items[1].amount", "6", true},
+		{"$.items.0.amount", "5", true},
+		{"$.empty", nil, true},
+		{"$.missing", nil, false},
+		{"$.nested.missing", nil, false},
+		{"$.items[2]", nil, false},
+		{"$.items[-1]", nil, false},
+		{"$.items[x]", nil, false},
+		{"$.amount.value", nil, false},
+		{"$.empty.value", nil, false},
+		{"$..amount", nil, false},
+	}
+	for _, test := range tests {
+		value, err := jsonPath(response, test.path)
+		if (err == nil) != test.ok || !reflect.DeepEqual(value, test.value) {
+			t.Errorf("jsonPath(%q) = %#v, %v, want %#v, ok %v", test.path, value, err, test.value, test.ok)
+		}
+	}
+
+	// The root is the whole response, and must be valid JSON
+	value, err := jsonPath([]byte(`"7"`), "$")
+	if err != nil || value != "7" {
+		t.Errorf(`jsonPath("7", "$") = %#v, %v`, value, err)
+	}
+	_, err = jsonPath([]byte(`{`), "$")
+	if err == nil {
+		t.Error("jsonPath of invalid JSON succeeded")
+	}
+}
+
+func TestUint64Value(t *testing.T) {
+	tests := []struct {
+		value  any
+		amount uint64
+		ok     bool
+	}{
+		{"1234", 1234, true},
+		{json.Number("1234"), 1234, true},
+		{json.Number("18446744073709551615"), 18446744073709551615, true},
+		{json.Number("1.5"), 0, false},
+		{json.Number("-1"), 0, false},
+		{"", 0, false},
+		{float64(12), 0, false},
+		{nil, 0, false},
+		{map[string]any{"amount": "1"}, 0, false},
+	}
+	for _, test := range tests {
+		amount, err := uint64Value(test.value)
+		if (err == nil) != test.ok || (test.ok && amount != test.amount) {
+			t.Errorf("uint64Value(%#v) = %d, %v, want %d, ok %v", test.value, amount, err, test.amount, test.ok)
+		}
+	}
+}
+
+func TestParseDropAtomQuery(t *testing.T) {
+	const contract = "neutron16m3hjh7l04kap086jgwthduma0r5l0wh8kc6kaqk92ge9n5aqvys9q6lxr"
+	const message = `{"total_bonded":{}}`
+	legacyURL := "https://rest.example.com/cosmwasm/wasm/v1/contract/" + contract + "/smart/" +
+		base64.StdEncoding.EncodeToString([]byte(message))
+
+	tests := []struct {
+		name     string
+		contract string
+		query    string
+		want     SmartQuery
+		legacy   bool
+		ok       bool
+	}{
+		{"message", contract, message, SmartQuery{Contract: contract, Message: message}, false, true},
+		{"message without contract", "", message, SmartQuery{}, false, false},
+		{"legacy URL", "", legacyURL, SmartQuery{Contract: contract, Message: message}, true, true},
+		{"legacy URL with its contract", contract, legacyURL, SmartQuery{Contract: contract, Message: message}, true, true},
+		{"legacy URL with another contract", "neutron1other", legacyURL, SmartQuery{}, true, false},
+		{"URL without a smart query", "", "https://rest.example.com/status", SmartQuery{}, true, false},
+		{"URL with a non-JSON message", "", "https://rest.example.com/contract/" + contract + "/smart/" +
+			base64.StdEncoding.EncodeToString([]byte("total_bonded")), SmartQuery{}, true, false},
+	}
+	for _, test := range tests {
+		query, legacy, err := parseDropAtomQuery(test.contract, test.query)
+		if (err == nil) != test.ok || legacy != test.legacy || query != test.want {
+			t.Errorf("%s: parseDropAtomQuery() = %+v, %v, %v, want %+v, %v, ok %v",
+				test.name, query, legacy, err, test.want, test.legacy, test.ok)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package indexer
+
+import (
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"gorm.io/gorm"
+)
+
+// previousHeight returns the height of the snapshot captured before height,
+// or zero if there is none
+func (i *Indexer) previousHeight(height int64) (int64, error) {
+	var previous models.DropletStatsHistory
+	result := i.db.Where("height < ?", height).Order("height DESC").First(&previous)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return 0, nil
+		}
+		return 0, result.Error
+	}
+	return previous.Height, nil
+}
+
+// balancesAtHeight returns the Droplets of every address stored in the
+// history for the snapshot at height, leaving out excluded addresses
+func (i *Indexer) balancesAtHeight(height int64) (map[string]uint64, error) {
+	var history []models.DropletAddressHistory
+	result := i.db.Select("address, droplets").
+		Where("height = ? AND excluded = ?", height, false).
+		Find(&history)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	balances := make(map[string]uint64, len(history))
+	for _, item := range history {
+		balances[item.Address] = item.Droplets
+	}
+	return balances, nil
+}
+
+// sortedBalances returns the Droplets of every address in the snapshot at
+// height in ascending order, leaving out excluded addresses
+func (i *Indexer) sortedBalances(height int64) ([]uint64, error) {
+	var balances []uint64
+	result := i.db.Model(&models.DropletAddressHistory{}).
+		Where("height = ? AND excluded = ?", height, false).
+		Order("droplets ASC").
+		Pluck("droplets", &balances)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return balances, nil
+}
@@ -0,0 +1,100 @@
+package indexer
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tendermint/tendermint/libs/bytes"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// stateLimit is the number of contract state entries fetched per page. RPCs
+// typically have a 100 item limit per request
+const stateLimit = uint64(100)
+
+// ContractState is the decoded contract state of the Droplets contract at a
+// height
+type ContractState struct {
+	Height int64 `json:"height"`
+	// Pages is the number of pages fetched
+	Pages int `json:"pages"`
+	// Keys is the number of raw keys scanned
+	Keys int `json:"keys"`
+	// BalanceKeys is the number of raw keys in the balance Map
+	BalanceKeys int `json:"balance_keys"`
+	// Droplets are the valid balances
+	Droplets []AddressDroplets `json:"droplets"`
+	// Quarantined are the balance entries that failed validation
+	Quarantined []QuarantinedKey `json:"quarantined"`
+	// Models are the raw keys and values scanned, kept only when the state
+	// is archived
+	Models []Model `json:"-"`
+	// TotalSupply is the cw20 total supply at the height, fetched before the
+	// snapshot is stored
+	TotalSupply uint64 `json:"-"`
+	// supplyErr is why the total supply couldn't be fetched, the snapshot
+	// is then stored as incomplete
+	supplyErr error
+}
+
+// fetchState fetches and decodes every page of the contract state at height,
+// following the pagination keys returned by the node until the last page
+func (i *Indexer) fetchState(ctx context.Context, height int64) (ContractState, error) {
+	state := ContractState{
+		Height: height,
+	}
+
+	offsetKey := bytes.HexBytes{}
+	for {
+		pageCtx, span := tracer.Start(ctx, "rpc.state_page")
+		span.SetAttributes(attribute.Int("page", state.Pages))
+		var page StatePage
+		err := i.retry(pageCtx, "fetch state page", func() (err error) {
+			page, err = i.getDroplets(pageCtx, height, offsetKey, stateLimit)
+			return err
+		})
+		endSpan(span, err)
+		if err != nil {
+			return state, err
+		}
+		state.Pages++
+		state.Keys += page.Keys
+		state.BalanceKeys += page.BalanceKeys
+		state.Droplets = append(state.Droplets, page.Droplets...)
+		state.Quarantined = append(state.Quarantined, page.Quarantined...)
+		if i.stateArchive != ArchiveNone {
+			state.Models = append(state.Models, page.Models...)
+		}
+		i.logger.WithFields(logrus.Fields{
+			"total": len(state.Droplets),
+		}).Debug("Droplets fetched")
+
+		if len(page.NextKey) == 0 {
+			break
+		}
+		offsetKey = page.NextKey
+
+		// Slow down to not query too hard, stopping between pages
+		select {
+		case <-ctx.Done():
+			return state, ctx.Err()
+		case <-time.After(time.Millisecond * 500):
+		}
+	}
+
+	return state, nil
+}
+
+// State fetches and decodes the contract state at height, the latest block
+// if height is zero
+func (i *Indexer) State(ctx context.Context, height int64) (ContractState, error) {
+	if height == 0 {
+		var err error
+		height, err = i.latestHeight(ctx)
+		if err != nil {
+			return ContractState{}, err
+		}
+	}
+	return i.fetchState(ctx, height)
+}
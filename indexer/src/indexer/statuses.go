@@ -0,0 +1,205 @@
+package indexer
+
+import (
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// updateAddressStatuses classifies the addresses of every captured snapshot
+// that hasn't been classified yet, oldest first so that every snapshot can
+// build on the one before it
+func (i *Indexer) updateAddressStatuses() error {
+	var snapshots []models.DropletStatsHistory
+	result := i.db.Where("height NOT IN (?)",
+		i.db.Model(&models.DropletStatusHistory{}).Select("height"),
+	).Order("height").Find(&snapshots)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, snapshot := range snapshots {
+		err := i.classifyAddresses(snapshot)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// classifyAddresses classifies every address in snapshot as new, active,
+// declining, idle, dormant or dropped compared to the previous snapshot and stores the
+// counts per status
+func (i *Indexer) classifyAddresses(snapshot models.DropletStatsHistory) error {
+	previousHeight, err := i.previousHeight(snapshot.Height)
+	if err != nil {
+		return err
+	}
+
+	current, err := i.balancesAtHeight(snapshot.Height)
+	if err != nil {
+		return err
+	}
+
+	var previousStatuses []models.DropletAddressStatus
+	result := i.db.Where("height = ? AND status <> ?", previousHeight, models.AddressStatusDropped).
+		Find(&previousStatuses)
+	if result.Error != nil {
+		return result.Error
+	}
+	previous := make(map[string]models.DropletAddressStatus, len(previousStatuses))
+	for _, status := range previousStatuses {
+		previous[status.Address] = status
+	}
+
+	// Addresses we haven't got a status for might still have been seen
+	// before, ie. when they reappear after being dropped
+	var unknown []string
+	for address := range current {
+		if _, ok := previous[address]; !ok {
+			unknown = append(unknown, address)
+		}
+	}
+	firstSeen, err := i.firstSeenHeights(unknown, snapshot.Height)
+	if err != nil {
+		return err
+	}
+
+	counts := models.DropletStatusHistory{
+		Height:      snapshot.Height,
+		DateBlock:   snapshot.DateBlock,
+		DateCreated: time.Now(),
+	}
+	statuses := make([]models.DropletAddressStatus, 0, len(current))
+	for address, droplets := range current {
+		status := models.DropletAddressStatus{
+			Address:         address,
+			Height:          snapshot.Height,
+			Droplets:        droplets,
+			FirstSeenHeight: snapshot.Height,
+			DateBlock:       snapshot.DateBlock,
+			DateCreated:     time.Now(),
+		}
+
+		var before *models.DropletAddressStatus
+		if previousStatus, ok := previous[address]; ok {
+			before = &previousStatus
+			status.FirstSeenHeight = before.FirstSeenHeight
+		} else if firstSeen[address] > 0 {
+			status.FirstSeenHeight = firstSeen[address]
+		}
+		status.Status, status.UnchangedCount = classifyStatus(before, droplets, firstSeen[address] > 0, i.dormantUpdates)
+		statuses = append(statuses, status)
+	}
+	for address, before := range previous {
+		if _, ok := current[address]; ok {
+			continue
+		}
+		statuses = append(statuses, models.DropletAddressStatus{
+			Address:         address,
+			Height:          snapshot.Height,
+			Status:          models.AddressStatusDropped,
+			Droplets:        before.Droplets,
+			FirstSeenHeight: before.FirstSeenHeight,
+			DateBlock:       snapshot.DateBlock,
+			DateCreated:     time.Now(),
+		})
+	}
+
+	for _, status := range statuses {
+		switch status.Status {
+		case models.AddressStatusNew:
+			counts.New++
+		case models.AddressStatusActive:
+			counts.Active++
+		case models.AddressStatusDeclining:
+			counts.Declining++
+		case models.AddressStatusIdle:
+			counts.Idle++
+		case models.AddressStatusDormant:
+			counts.Dormant++
+		case models.AddressStatusDropped:
+			counts.Dropped++
+		}
+	}
+
+	// Store the statuses and counts together so a failed pass classifies
+	// the snapshot again
+	err = i.db.Transaction(func(tx *gorm.DB) error {
+		if len(statuses) > 0 {
+			result := tx.CreateInBatches(statuses, 1000)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+		return tx.Save(&counts).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"height":    snapshot.Height,
+		"new":       counts.New,
+		"active":    counts.Active,
+		"declining": counts.Declining,
+		"idle":      counts.Idle,
+		"dormant":   counts.Dormant,
+		"dropped":   counts.Dropped,
+	}).Debug("Address statuses updated")
+
+	return nil
+}
+
+// classifyStatus returns the status of an address holding droplets and the
+// number of updates its balance has been unchanged for, given its status in
+// the previous snapshot, nil if it wasn't in it. Returning addresses were
+// seen before the previous snapshot
+func classifyStatus(previous *models.DropletAddressStatus, droplets uint64, returning bool, dormantUpdates int) (string, int) {
+	switch {
+	case previous == nil && returning:
+		return models.AddressStatusActive, 0
+	case previous == nil:
+		return models.AddressStatusNew, 0
+	case droplets > previous.Droplets:
+		return models.AddressStatusActive, 0
+	case droplets < previous.Droplets:
+		return models.AddressStatusDeclining, 0
+	}
+	unchanged := previous.UnchangedCount + 1
+	if unchanged >= dormantUpdates {
+		return models.AddressStatusDormant, unchanged
+	}
+	return models.AddressStatusIdle, unchanged
+}
+
+// firstSeenHeights returns the first height each of the addresses appears
+// in the history before height. Addresses never seen before are omitted
+func (i *Indexer) firstSeenHeights(addresses []string, height int64) (map[string]int64, error) {
+	firstSeen := make(map[string]int64)
+	for start := 0; start < len(addresses); start += 1000 {
+		end := start + 1000
+		if end > len(addresses) {
+			end = len(addresses)
+		}
+
+		var rows []struct {
+			Address string
+			Height  int64
+		}
+		result := i.db.Model(&models.DropletAddressHistory{}).
+			Select("address, MIN(height) AS height").
+			Where("height < ? AND excluded = ? AND address IN ?", height, false, addresses[start:end]).
+			Group("address").
+			Scan(&rows)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		for _, row := range rows {
+			firstSeen[row.Address] = row.Height
+		}
+	}
+	return firstSeen, nil
+}
@@ -0,0 +1,38 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+)
+
+func TestClassifyStatus(t *testing.T) {
+	previous := func(droplets uint64, unchanged int) *models.DropletAddressStatus {
+		return &models.DropletAddressStatus{Droplets: droplets, UnchangedCount: unchanged}
+	}
+	tests := []struct {
+		name      string
+		previous  *models.DropletAddressStatus
+		droplets  uint64
+		returning bool
+		status    string
+		unchanged int
+	}{
+		{"first seen", nil, 10, false, models.AddressStatusNew, 0},
+		{"returning", nil, 10, true, models.AddressStatusActive, 0},
+		{"grew", previous(10, 2), 11, false, models.AddressStatusActive, 0},
+		{"fell", previous(10, 2), 9, false, models.AddressStatusDeclining, 0},
+		{"fell to zero", previous(10, 0), 0, false, models.AddressStatusDeclining, 0},
+		{"unchanged", previous(10, 0), 10, false, models.AddressStatusIdle, 1},
+		{"unchanged below threshold", previous(10, 1), 10, false, models.AddressStatusIdle, 2},
+		{"unchanged at threshold", previous(10, 2), 10, false, models.AddressStatusDormant, 3},
+		{"unchanged past threshold", previous(10, 5), 10, false, models.AddressStatusDormant, 6},
+	}
+	for _, test := range tests {
+		status, unchanged := classifyStatus(test.previous, test.droplets, test.returning, 3)
+		if status != test.status || unchanged != test.unchanged {
+			t.Errorf("%s: classifyStatus = %s, %d, want %s, %d",
+				test.name, status, unchanged, test.status, test.unchanged)
+		}
+	}
+}
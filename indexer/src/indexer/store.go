@@ -0,0 +1,337 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// rankingQuery ranks the leaderboard by Droplets
+const rankingQuery = `
+	WITH ranked_droplets AS (
+	SELECT
+		id,
+		ROW_NUMBER() OVER (ORDER BY droplets DESC) AS rank  -- Calculate rank based on descending order of 'droplets'
+	FROM
+		droplet_leaderboard
+	)
+	UPDATE droplet_leaderboard
+	SET position = ranked_droplets.rank  -- Update the 'position' column with the calculated rank
+	FROM ranked_droplets
+	WHERE droplet_leaderboard.id = ranked_droplets.id;  -- Match each row by 'id'
+`
+
+// insert creates value in tx. Rows stored for the snapshot before the
+// writes were transactional are ignored
+func insert(tx *gorm.DB, op string, value any) error {
+	result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(value)
+	if result.Error != nil {
+		return dbError(op, result.Error)
+	}
+	return nil
+}
+
+// insertTolerated creates value in tx like insert. When failed writes are
+// tolerated, the insert is wrapped in a savepoint so a failure doesn't abort
+// the transaction
+func (i *Indexer) insertTolerated(tx *gorm.DB, op string, value any) error {
+	if i.maxWriteFailures == 0 {
+		return insert(tx, op, value)
+	}
+
+	result := tx.SavePoint("write")
+	if result.Error != nil {
+		return dbError(op, result.Error)
+	}
+	err := insert(tx, op, value)
+	if err != nil {
+		result = tx.RollbackTo("write")
+		if result.Error != nil {
+			return dbError(op, result.Error)
+		}
+	}
+	return err
+}
+
+// storeSnapshot writes the snapshot in state to the history, publishes it
+// to the leaderboard when publish is set and records its stats, all in tx.
+// The stop of ctx is checked between addresses and phases. A nil
+// dropStakedAtom keeps the dATOM total already stored for the height, if any
+func (i *Indexer) storeSnapshot(
+	ctx context.Context,
+	tx *gorm.DB,
+	run *models.IndexerRun,
+	state ContractState,
+	dropStakedAtom *uint64,
+	dateBlock time.Time,
+	skiplist *Skiplist,
+	publish bool) error {
+
+	height := state.Height
+	var err error
+
+	// Save the Drop staked ATOM totals
+	if dropStakedAtom != nil {
+		dropStakedAtomModel := models.DropAtomHistory{
+			TotalAtom:   *dropStakedAtom,
+			Height:      height,
+			DateBlock:   dateBlock,
+			DateCreated: time.Now(),
+		}
+		err = insert(tx, "store dATOM", &dropStakedAtomModel)
+		if err != nil {
+			i.logger.WithFields(logrus.Fields{
+				"total": *dropStakedAtom,
+				"err":   err,
+			}).Error("Unable to store Drop staked ATOM")
+			return err
+		}
+	}
+
+	// The history and the leaderboard are written address by address,
+	// so they share a span
+	_, storeSpan := tracer.Start(ctx, "store.history_and_leaderboard")
+
+	// Clear the leaderboard. Readers keep seeing the previous snapshot until
+	// the transaction commits
+	if publish {
+		result := tx.Exec("DELETE FROM droplet_leaderboard")
+		if result.Error != nil {
+			err = dbError("clear leaderboard", result.Error)
+			i.logger.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("Unable to clear leaderboard")
+			endSpan(storeSpan, err)
+			return err
+		}
+		i.logger.Debug("Leaderboard cleared")
+	}
+
+	// Writes failing are tolerated up to the configured limit, after which
+	// the snapshot is abandoned
+	writeFailures := 0
+	tooManyFailures := func(err error) error {
+		writeFailures++
+		if writeFailures <= i.maxWriteFailures {
+			return nil
+		}
+		endSpan(storeSpan, err)
+		return fmt.Errorf("abandoning snapshot after %d failed writes: %w", writeFailures, err)
+	}
+
+	i.logger.Info("Processing Droplets")
+
+	// Capture all the droplets for datetime/lastOnchainUpdateTime
+	for _, account := range state.Droplets {
+		if ctx.Err() != nil {
+			endSpan(storeSpan, ctx.Err())
+			return ctx.Err()
+		}
+
+		// Addresses on the skiplist are stored in the history, but kept
+		// off the leaderboard
+		entry, excluded := skiplist.Match(account.Address, dateBlock)
+
+		// Store the history item
+		historyModel := models.DropletAddressHistory{
+			Address:     account.Address,
+			Droplets:    account.Droplets,
+			Excluded:    excluded,
+			Height:      height,
+			DateBlock:   dateBlock,
+			DateCreated: time.Now(),
+		}
+		err = i.insertTolerated(tx, "store history", &historyModel)
+		if err != nil {
+			i.logger.WithFields(logrus.Fields{
+				"address":  account.Address,
+				"droplets": account.Droplets,
+				"err":      err,
+			}).Error("Unable to store history")
+			err = tooManyFailures(err)
+			if err != nil {
+				return err
+			}
+		}
+
+		if excluded {
+			i.logger.WithFields(logrus.Fields{
+				"address":  account.Address,
+				"category": entry.Category,
+			}).Debug("Skipping address")
+			run.AddressesSkipped++
+
+			exclusionModel := models.DropletExclusionHistory{
+				Address:         account.Address,
+				Height:          height,
+				Droplets:        account.Droplets,
+				SkiplistEntryID: entry.ID,
+				Category:        entry.Category,
+				Reason:          entry.Reason,
+				DateBlock:       dateBlock,
+				DateCreated:     time.Now(),
+			}
+			err = i.insertTolerated(tx, "store exclusion", &exclusionModel)
+			if err != nil {
+				i.logger.WithFields(logrus.Fields{
+					"address": account.Address,
+					"err":     err,
+				}).Error("Unable to store exclusion")
+				err = tooManyFailures(err)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		if !publish {
+			continue
+		}
+
+		// Add to the leaderboard
+		leaderboardModel := models.DropletLeaderboard{
+			Address:  account.Address,
+			Droplets: account.Droplets,
+			Height:   height,
+
+			DateBlock:   dateBlock,
+			DateCreated: time.Now(),
+		}
+		err = i.insertTolerated(tx, "store leaderboard", &leaderboardModel)
+		if err != nil {
+			i.logger.WithFields(logrus.Fields{
+				"address":  account.Address,
+				"droplets": account.Droplets,
+				"err":      err,
+			}).Error("Unable to store leaderboard item")
+			err = tooManyFailures(err)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	storeSpan.SetAttributes(
+		attribute.Int("addresses", len(state.Droplets)),
+		attribute.Int64("skipped", run.AddressesSkipped),
+	)
+	storeSpan.End()
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	// Rank the leaderboard
+	if publish {
+		_, rankSpan := tracer.Start(ctx, "store.rank")
+		result := tx.Exec(rankingQuery)
+		if result.Error != nil {
+			err = dbError("rank leaderboard", result.Error)
+			endSpan(rankSpan, err)
+			i.logger.WithFields(logrus.Fields{
+				"err": err,
+			}).Error("Unable to rank leaderboard")
+			return err
+		}
+		rankSpan.End()
+
+		i.logger.Info("Leaderboard rankes inserted")
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	_, statsSpan := tracer.Start(ctx, "store.stats")
+
+	// Count unique addresses in the dashboard, the addresses of the snapshot
+	// kept off the leaderboard by the skiplist aren't counted
+	var totalUniqueAddresses int64
+	result := tx.Model(&models.DropletAddressHistory{}).
+		Where("height = ? AND excluded = ?", height, false).
+		Select("DISTINCT(address)").
+		Count(&totalUniqueAddresses)
+	if result.Error != nil {
+		err = dbError("count unique addresses", result.Error)
+		endSpan(statsSpan, err)
+		return err
+	}
+
+	// Count total droplets in the dashboard
+	var totalDroplets int64
+	// Sum the droplets
+	result = tx.Model(&models.DropletAddressHistory{}).
+		Where("height = ? AND excluded = ?", height, false).
+		Select("COALESCE(SUM(droplets), 0)").
+		Scan(&totalDroplets)
+	if result.Error != nil {
+		err = dbError("count total droplets", result.Error)
+		endSpan(statsSpan, err)
+		return err
+	}
+
+	// Count the totals including the excluded addresses
+	var totalsAll struct {
+		Droplets  int64
+		Addresses int64
+	}
+	result = tx.Model(&models.DropletAddressHistory{}).
+		Select("COALESCE(SUM(droplets), 0) AS droplets, COUNT(DISTINCT(address)) AS addresses").
+		Where("height = ?", height).
+		Scan(&totalsAll)
+	if result.Error != nil {
+		err = dbError("count totals including excluded addresses", result.Error)
+		endSpan(statsSpan, err)
+		return err
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"total":     totalDroplets,
+		"total_all": totalsAll.Droplets,
+		"count":     len(state.Droplets),
+	}).Info("Droplet history updated")
+
+	// Check the capture is complete against the contract totals
+	_, verifySpan := tracer.Start(ctx, "verify")
+	verification := i.verifyState(state, totalsAll.Addresses, totalsAll.Droplets)
+	verifySpan.SetAttributes(attribute.String("status", verification.Status))
+	verifySpan.End()
+	i.logger.WithFields(logrus.Fields{
+		"status":  verification.Status,
+		"reasons": verification.Reasons,
+	}).Info("Snapshot verified")
+
+	// Log the stats history
+	statsModel := models.DropletStatsHistory{
+		TotalDroplets:     totalDroplets,
+		TotalAddresses:    totalUniqueAddresses,
+		TotalDropletsAll:  totalsAll.Droplets,
+		TotalAddressesAll: totalsAll.Addresses,
+		Height:            height,
+
+		VerificationStatus: verification.Status,
+		KeysScanned:        int64(verification.KeysScanned),
+		TotalSupply:        int64(verification.TotalSupply),
+
+		DateBlock:   dateBlock,
+		DateCreated: time.Now(),
+	}
+	err = insert(tx, "store stats", &statsModel)
+	endSpan(statsSpan, err)
+	if err != nil {
+		i.logger.WithFields(logrus.Fields{
+			"total_address":  totalUniqueAddresses,
+			"total_droplets": totalDroplets,
+			"err":            err,
+		}).Error("Unable to store stats item")
+		return err
+	}
+
+	return ctx.Err()
+}
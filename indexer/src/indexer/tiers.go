@@ -0,0 +1,99 @@
+package indexer
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+)
+
+// TierRanks are the leaderboard ranks precomputed for every snapshot
+var TierRanks = []int64{1, 10, 100, 1000, 10000}
+
+// TierPercentiles are the top percentiles of addresses precomputed for
+// every snapshot
+var TierPercentiles = []float64{0.1, 1, 5, 10, 25, 50}
+
+// computeRankTiers returns the Droplets needed to reach each of the
+// TierRanks and TierPercentiles. An address with X Droplets ranks one more
+// than the number of addresses holding more than X, so the threshold for
+// rank N is the balance currently at rank N. Balances must be sorted in
+// ascending order
+func computeRankTiers(balances []uint64) []models.DropletRankTier {
+	n := int64(len(balances))
+	if n == 0 {
+		return nil
+	}
+	// atRank returns the balance at the 1-based descending rank
+	atRank := func(rank int64) uint64 {
+		return balances[n-rank]
+	}
+
+	var tiers []models.DropletRankTier
+	for _, rank := range TierRanks {
+		if rank > n {
+			break
+		}
+		tiers = append(tiers, models.DropletRankTier{
+			Tier:       fmt.Sprintf("top_%d", rank),
+			Rank:       rank,
+			Percentile: float64(rank) / float64(n) * 100,
+			Droplets:   atRank(rank),
+		})
+	}
+	for _, percentile := range TierPercentiles {
+		rank := int64(math.Ceil(percentile / 100 * float64(n)))
+		if rank < 1 {
+			rank = 1
+		}
+		tiers = append(tiers, models.DropletRankTier{
+			Tier:       "top_" + strconv.FormatFloat(percentile, 'f', -1, 64) + "%",
+			Rank:       rank,
+			Percentile: percentile,
+			Droplets:   atRank(rank),
+		})
+	}
+	return tiers
+}
+
+// updateRankTiers precomputes the rank tiers of every captured snapshot that
+// doesn't have them yet. A snapshot without addresses outside the skiplist
+// has no tiers, its stats say so rather than the missing tiers
+func (i *Indexer) updateRankTiers() error {
+	var snapshots []models.DropletStatsHistory
+	result := i.db.Where("height NOT IN (?) AND total_addresses > 0",
+		i.db.Model(&models.DropletRankTier{}).Select("height"),
+	).Order("height").Find(&snapshots)
+	if result.Error != nil {
+		return result.Error
+	}
+
+	for _, snapshot := range snapshots {
+		balances, err := i.sortedBalances(snapshot.Height)
+		if err != nil {
+			return err
+		}
+
+		tiers := computeRankTiers(balances)
+		for index := range tiers {
+			tiers[index].Height = snapshot.Height
+			tiers[index].DateBlock = snapshot.DateBlock
+			tiers[index].DateCreated = time.Now()
+		}
+		if len(tiers) > 0 {
+			result = i.db.Create(&tiers)
+			if result.Error != nil {
+				return result.Error
+			}
+		}
+
+		i.logger.WithFields(logrus.Fields{
+			"height": snapshot.Height,
+			"count":  len(tiers),
+		}).Debug("Rank tiers updated")
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package indexer
+
+import "testing"
+
+func TestComputeRankTiers(t *testing.T) {
+	if tiers := computeRankTiers(nil); tiers != nil {
+		t.Errorf("computeRankTiers(nil) = %v, want nil", tiers)
+	}
+
+	balances := make([]uint64, 20)
+	for index := range balances {
+		balances[index] = uint64(index + 1)
+	}
+	tests := []struct {
+		tier     string
+		rank     int64
+		droplets uint64
+	}{
+		{"top_1", 1, 20},
+		{"top_10", 10, 11},
+		{"top_0.1%", 1, 20},
+		{"top_1%", 1, 20},
+		{"top_5%", 1, 20},
+		{"top_10%", 2, 19},
+		{"top_25%", 5, 16},
+		{"top_50%", 10, 11},
+	}
+	tiers := computeRankTiers(balances)
+	if len(tiers) != len(tests) {
+		t.Fatalf("computeRankTiers returned %d tiers, want %d", len(tiers), len(tests))
+	}
+	for index, test := range tests {
+		tier := tiers[index]
+		if tier.Tier != test.tier || tier.Rank != test.rank || tier.Droplets != test.droplets {
+			t.Errorf("tier %d = %s rank %d with %d, want %s rank %d with %d",
+				index, tier.Tier, tier.Rank, tier.Droplets, test.tier, test.rank, test.droplets)
+		}
+	}
+}
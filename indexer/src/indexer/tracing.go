@@ -0,0 +1,20 @@
+package indexer
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the indexer stages. It uses the global tracer
+// provider, a no-op unless tracing is set up
+var tracer = otel.Tracer("github.com/donovansolms/droplets-dashboard/indexer/src/indexer")
+
+// endSpan records err on span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
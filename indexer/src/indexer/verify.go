@@ -0,0 +1,199 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer/models"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Snapshot verification statuses stored in the stats history
+const (
+	// VerificationVerified is a snapshot matching the contract totals
+	VerificationVerified = "verified"
+	// VerificationMismatched is a complete snapshot whose sum of balances
+	// doesn't match the contract's total supply
+	VerificationMismatched = "mismatched"
+	// VerificationIncomplete is a snapshot missing keys of the contract state
+	VerificationIncomplete = "incomplete"
+)
+
+// Verification is the result of checking a snapshot against the contract
+type Verification struct {
+	Height          int64    `json:"height"`
+	Status          string   `json:"status"`
+	Reasons         []string `json:"reasons,omitempty"`
+	KeysScanned     int      `json:"keys_scanned"`
+	BalanceKeys     int      `json:"balance_keys"`
+	Quarantined     int      `json:"quarantined"`
+	StoredAddresses int64    `json:"stored_addresses"`
+	StoredDroplets  int64    `json:"stored_droplets"`
+	TotalSupply     uint64   `json:"total_supply"`
+}
+
+// tokenInfoResponse is the response of the cw20 token_info query
+type tokenInfoResponse struct {
+	TotalSupply string `json:"total_supply"`
+}
+
+// getTotalSupply fetches the cw20 total supply of the Droplets contract at
+// height
+func (i *Indexer) getTotalSupply(ctx context.Context, height int64) (uint64, error) {
+	const op = "query total supply"
+
+	var supply uint64
+	err := i.retry(ctx, op, func() error {
+		var response QuerySmartContractStateResponse
+		err := i.abciQuery(
+			ctx,
+			"/cosmwasm.wasm.v1.Query/SmartContractState",
+			&QuerySmartContractStateRequest{
+				Address:   i.dropletsContractAddress,
+				QueryData: []byte(`{"token_info":{}}`),
+			},
+			height,
+			&response,
+		)
+		if err != nil {
+			return err
+		}
+
+		var tokenInfo tokenInfoResponse
+		err = json.Unmarshal(response.Data, &tokenInfo)
+		if err != nil {
+			return dataError(op, fmt.Errorf("unable to parse token info: %v", err))
+		}
+		supply, err = strconv.ParseUint(tokenInfo.TotalSupply, 10, 64)
+		if err != nil {
+			return dataError(op, fmt.Errorf("invalid total supply %q: %v", tokenInfo.TotalSupply, err))
+		}
+		return nil
+	})
+	return supply, err
+}
+
+// fetchTotalSupply sets the total supply of state, recording why it couldn't
+// be fetched unless the fetch was cancelled
+func (i *Indexer) fetchTotalSupply(ctx context.Context, state *ContractState) error {
+	supply, err := i.getTotalSupply(ctx, state.Height)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		state.supplyErr = err
+		return nil
+	}
+	state.TotalSupply = supply
+	return nil
+}
+
+// verifyState checks the state scanned at a height and what was stored from
+// it against the contract's total supply at that height, which is fetched
+// beforehand so verifying doesn't query the chain
+func (i *Indexer) verifyState(state ContractState, storedAddresses int64, storedDroplets int64) Verification {
+	verification := Verification{
+		Height:          state.Height,
+		Status:          VerificationVerified,
+		KeysScanned:     state.Keys,
+		BalanceKeys:     state.BalanceKeys,
+		Quarantined:     len(state.Quarantined),
+		StoredAddresses: storedAddresses,
+		StoredDroplets:  storedDroplets,
+	}
+
+	if len(state.Quarantined) > 0 {
+		verification.Status = VerificationIncomplete
+		verification.Reasons = append(verification.Reasons,
+			fmt.Sprintf("%d balance keys failed validation", len(state.Quarantined)))
+	}
+	if int64(state.BalanceKeys) != storedAddresses {
+		verification.Status = VerificationIncomplete
+		verification.Reasons = append(verification.Reasons,
+			fmt.Sprintf("%d balance keys scanned but %d addresses stored", state.BalanceKeys, storedAddresses))
+	}
+
+	if state.supplyErr != nil {
+		verification.Status = VerificationIncomplete
+		verification.Reasons = append(verification.Reasons,
+			fmt.Sprintf("unable to fetch total supply: %v", state.supplyErr))
+		return verification
+	}
+	supply := state.TotalSupply
+	verification.TotalSupply = supply
+
+	if verification.Status == VerificationVerified && uint64(storedDroplets) != supply {
+		verification.Status = VerificationMismatched
+		verification.Reasons = append(verification.Reasons,
+			fmt.Sprintf("stored balances sum to %d but the total supply is %d", storedDroplets, supply))
+	}
+	return verification
+}
+
+// Verify rescans the contract state at a captured height, the latest if
+// zero, checks the stored snapshot against it and records the result in
+// the stats history. A rescan that fails leaves the stored status as it was
+func (i *Indexer) Verify(ctx context.Context, height int64) (Verification, error) {
+	db := i.db.WithContext(ctx)
+	var snapshot models.DropletStatsHistory
+	query := db.Order("height DESC")
+	if height > 0 {
+		query = query.Where("height = ?", height)
+	}
+	result := query.First(&snapshot)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return Verification{}, fmt.Errorf("no snapshot captured at height %d", height)
+		}
+		return Verification{}, result.Error
+	}
+
+	var stored struct {
+		Droplets  int64
+		Addresses int64
+	}
+	result = db.Model(&models.DropletAddressHistory{}).
+		Select("COALESCE(SUM(droplets), 0) AS droplets, COUNT(DISTINCT(address)) AS addresses").
+		Where("height = ?", snapshot.Height).
+		Scan(&stored)
+	if result.Error != nil {
+		return Verification{}, result.Error
+	}
+
+	// Only a finished scan is compared, a timeout or a stop says nothing
+	// about the snapshot
+	state, err := i.fetchState(ctx, snapshot.Height)
+	if err != nil {
+		return Verification{}, fmt.Errorf("unable to scan contract state: %w", err)
+	}
+	err = i.fetchTotalSupply(ctx, &state)
+	if err != nil {
+		return Verification{}, err
+	}
+	if state.supplyErr != nil {
+		return Verification{}, fmt.Errorf("unable to fetch total supply: %v", state.supplyErr)
+	}
+	verification := i.verifyState(state, stored.Addresses, stored.Droplets)
+
+	result = db.Model(&models.DropletStatsHistory{}).
+		Where("height = ?", snapshot.Height).
+		Updates(map[string]any{
+			"verification_status": verification.Status,
+			"keys_scanned":        verification.KeysScanned,
+			"total_supply":        int64(verification.TotalSupply),
+		})
+	if result.Error != nil {
+		return verification, result.Error
+	}
+
+	i.logger.WithFields(logrus.Fields{
+		"height":  verification.Height,
+		"status":  verification.Status,
+		"reasons": verification.Reasons,
+	}).Info("Snapshot verified")
+
+	return verification, nil
+}
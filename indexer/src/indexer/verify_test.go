@@ -0,0 +1,87 @@
+package indexer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestVerifyState(t *testing.T) {
+	tests := []struct {
+		name            string
+		state           ContractState
+		storedAddresses int64
+		storedDroplets  int64
+		status          string
+		reasons         int
+		totalSupply     uint64
+	}{
+		{
+			name:            "verified",
+			state:           ContractState{BalanceKeys: 2, TotalSupply: 300},
+			storedAddresses: 2,
+			storedDroplets:  300,
+			status:          VerificationVerified,
+			totalSupply:     300,
+		},
+		{
+			name:            "mismatched supply",
+			state:           ContractState{BalanceKeys: 2, TotalSupply: 301},
+			storedAddresses: 2,
+			storedDroplets:  300,
+			status:          VerificationMismatched,
+			reasons:         1,
+			totalSupply:     301,
+		},
+		{
+			name:            "quarantined keys",
+			state:           ContractState{BalanceKeys: 3, Quarantined: []QuarantinedKey{{}}, TotalSupply: 300},
+			storedAddresses: 3,
+			storedDroplets:  300,
+			status:          VerificationIncomplete,
+			reasons:         1,
+			totalSupply:     300,
+		},
+		{
+			name:            "missing addresses",
+			state:           ContractState{BalanceKeys: 3, TotalSupply: 301},
+			storedAddresses: 2,
+			storedDroplets:  300,
+			status:          VerificationIncomplete,
+			reasons:         1,
+			totalSupply:     301,
+		},
+		{
+			name:            "quarantined and missing addresses",
+			state:           ContractState{BalanceKeys: 3, Quarantined: []QuarantinedKey{{}}, TotalSupply: 300},
+			storedAddresses: 2,
+			storedDroplets:  300,
+			status:          VerificationIncomplete,
+			reasons:         2,
+			totalSupply:     300,
+		},
+		{
+			name:            "unknown supply",
+			state:           ContractState{BalanceKeys: 2, supplyErr: errors.New("node unavailable")},
+			storedAddresses: 2,
+			storedDroplets:  300,
+			status:          VerificationIncomplete,
+			reasons:         1,
+		},
+	}
+
+	indexer := &Indexer{}
+	for _, test := range tests {
+		verification := indexer.verifyState(test.state, test.storedAddresses, test.storedDroplets)
+		if verification.Status != test.status || len(verification.Reasons) != test.reasons {
+			t.Errorf("%s: verifyState = %s %q, want %s with %d reasons",
+				test.name, verification.Status, verification.Reasons, test.status, test.reasons)
+		}
+		if verification.TotalSupply != test.totalSupply {
+			t.Errorf("%s: verifyState total supply %d, want %d", test.name, verification.TotalSupply, test.totalSupply)
+		}
+		if verification.Quarantined != len(test.state.Quarantined) {
+			t.Errorf("%s: verifyState quarantined %d, want %d",
+				test.name, verification.Quarantined, len(test.state.Quarantined))
+		}
+	}
+}
@@ -1,13 +1,23 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/donovansolms/droplets-dashboard/indexer/src/api"
 	"github.com/donovansolms/droplets-dashboard/indexer/src/indexer"
+	"github.com/donovansolms/droplets-dashboard/indexer/src/settings"
+	"github.com/donovansolms/droplets-dashboard/indexer/src/tracing"
 	"github.com/kelseyhightower/envconfig"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -16,18 +26,78 @@ type Config struct {
 	LogFormat   string `envconfig:"LOG_FORMAT" required:"true"`
 	LogLevel    string `envconfig:"LOG_LEVEL" required:"true"`
 	ServiceName string `envconfig:"SERVICE_NAME" required:"true"`
+	APIEnabled  bool   `envconfig:"API_ENABLED" required:"false"`
+
+	MetricsListenAddress string `envconfig:"METRICS_LISTEN_ADDRESS" required:"false"`
+
+	// DrainTimeout is how long a stop waits for the pass in flight
+	DrainTimeout time.Duration `envconfig:"DRAIN_TIMEOUT" default:"30s"`
 }
 
+// Exit codes of the service
+const (
+	// exitStopped is a command that finished, or a clean stop on a signal
+	exitStopped = 0
+	// exitFailure is a pass, a command or the API failing
+	exitFailure = 1
+	// exitDrainTimeout is a stop that didn't drain within the timeout
+	exitDrainTimeout = 2
+	// exitUsage is an unknown command or invalid flags
+	exitUsage = 3
+)
+
 func main() {
+	command, args := parseCommand(os.Args[1:])
+	if command == "help" {
+		usage(os.Stdout)
+		return
+	}
+	if _, ok := commands[command]; !ok && !serves(command) && command != "config" {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", command)
+		usage(os.Stderr)
+		os.Exit(exitUsage)
+	}
+
+	// Load the config file, the environment overrides it
+	err := settings.Load(configSpecs("", true)...)
+	if err != nil {
+		log.Fatalf("Unable to load config file: %s", err)
+	}
+
 	// Parse config environment variables
 	var config Config
-	err := envconfig.Process("", &config)
+	err = envconfig.Process("", &config)
+
+	// Print the effective config instead of running, including the API
+	// settings whenever the API is enabled. API_ENABLED is read on its own
+	// since the config isn't processed when a required setting is missing
+	if command == "config" {
+		if len(args) != 1 || args[0] != "print" {
+			usage(os.Stderr)
+			os.Exit(exitUsage)
+		}
+		apiEnabled, _ := strconv.ParseBool(os.Getenv("API_ENABLED"))
+		printConfig(configSpecs("", apiEnabled))
+		return
+	}
+
+	// The API only runs when serving
+	apiEnabled := config.APIEnabled && serves(command)
+
 	if err != nil {
 		log.Fatalf("Unable to process config: %s", err)
 	}
+	err = settings.Validate(configSpecs(command, apiEnabled)...)
+	if err != nil {
+		log.Fatalf("Invalid config: %s", err)
+	}
 
-	// Set up structured logging
+	// Set up structured logging. Commands write their output to stdout, so
+	// they log to stderr
 	log.SetOutput(os.Stdout)
+	if !serves(command) {
+		log.SetOutput(os.Stderr)
+	}
 	log.SetFormatter(&log.JSONFormatter{
 		TimestampFormat: "Jan 02 15:04:05",
 	})
@@ -46,33 +116,177 @@ func main() {
 		"service": strings.ToLower(config.ServiceName),
 	})
 
+	// Set up tracing, flushing the spans on exit
+	shutdownTracing, err := tracing.Setup(strings.ToLower(config.ServiceName))
+	if err != nil {
+		logger.Fatalf("Unable to set up tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	// Set up signal handler, ie ctrl+c
 	signalChannel := make(chan os.Signal, 1)
 	signal.Notify(signalChannel, syscall.SIGINT, syscall.SIGTERM)
 
 	// Construct the service
 	logger.Info("Init service")
-	service, err := indexer.New(
-		logger,
-	)
+	var service *indexer.Indexer
+	if commands[command].readOnly {
+		service, err = indexer.NewReader(logger)
+	} else {
+		service, err = indexer.New(logger)
+	}
 	if err != nil {
 		logger.Fatalf("Unable to create service: %v", err)
 	}
 
-	// Handle stop signals
+	// Stop on a signal. The pass in flight is cancelled and its snapshot
+	// rolled back, if it doesn't stop within the drain timeout the process
+	// exits anyway
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	go func() {
 		sig := <-signalChannel
 		logger.WithFields(log.Fields{
-			"signal": sig,
-		}).Info("Received OS signal")
-		service.Stop()
+			"signal":        sig,
+			"drain_timeout": config.DrainTimeout,
+		}).Info("Received OS signal, draining")
+		time.AfterFunc(config.DrainTimeout, func() {
+			logger.Error("Drain timeout exceeded, exiting")
+			shutdownTracing(context.Background())
+			os.Exit(exitDrainTimeout)
+		})
+		cancel()
 	}()
 
-	// Run forever
-	err = service.Run()
-	if err != nil {
-		logger.Fatalf("Unable to run service: %v", err)
+	var exitCode int
+	if serves(command) {
+		exitCode = serve(ctx, config, logger, service, command == "run")
+	} else {
+		exitCode = commands[command].run(ctx, logger, service, args)
 	}
 
-	logger.Info("Shutdown")
+	logger.WithFields(log.Fields{
+		"exit_code": exitCode,
+	}).Info("Shutdown")
+
+	// os.Exit skips the deferred calls, flush the spans first
+	shutdownTracing(context.Background())
+	os.Exit(exitCode)
+}
+
+// serves returns true if command serves the API, the metrics and the health
+// checks while indexing. Without a command a single pass runs, as before
+// the commands were added
+func serves(command string) bool {
+	return command == "" || command == "run"
+}
+
+// serve runs the indexer along with the API and the metrics server until
+// stopped. The daemon runs a pass every PASS_INTERVAL, otherwise a single
+// pass runs and the API is served until stopped
+func serve(ctx context.Context, config Config, logger *log.Entry, service *indexer.Indexer, daemon bool) int {
+	// Construct the API if enabled
+	var apiService *api.API
+	apiDone := make(chan error, 1)
+	if config.APIEnabled {
+		var err error
+		apiService, err = api.New(logger)
+		if err != nil {
+			logger.Errorf("Unable to create API: %v", err)
+			return exitFailure
+		}
+		apiService.SetChecks(service.Healthy, service.Ready)
+		apiService.SetBalanceLookup(service.CheckBalance)
+		go func() {
+			apiDone <- apiService.Run()
+		}()
+	}
+
+	// Serve the metrics and health checks on their own address if set,
+	// they're also served by the API
+	var metricsServer *http.Server
+	if config.MetricsListenAddress != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", promhttp.Handler())
+		mux.HandleFunc("/healthz", api.CheckHandler(service.Healthy))
+		mux.HandleFunc("/readyz", api.CheckHandler(service.Ready))
+		metricsServer = &http.Server{
+			Addr:              config.MetricsListenAddress,
+			Handler:           mux,
+			ReadHeaderTimeout: time.Second * 10,
+		}
+		go func() {
+			logger.WithFields(log.Fields{
+				"address": config.MetricsListenAddress,
+			}).Info("Serving metrics")
+			err := metricsServer.ListenAndServe()
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Errorf("Unable to serve metrics: %v", err)
+			}
+		}()
+	}
+
+	// Stop serving when stopped
+	go func() {
+		<-ctx.Done()
+		if apiService != nil {
+			apiService.Stop()
+		}
+		if metricsServer != nil {
+			metricsServer.Shutdown(context.Background())
+		}
+	}()
+
+	// Run until stopped
+	run := service.Run
+	if daemon {
+		run = service.Daemon
+	}
+	exitCode := runExitCode(logger, run(ctx))
+
+	// Wait for the API to stop serving
+	if apiService != nil {
+		if exitCode != exitStopped {
+			apiService.Stop()
+		}
+		err := <-apiDone
+		if err != nil {
+			logger.Errorf("Unable to run API: %v", err)
+			exitCode = exitFailure
+		}
+	}
+	return exitCode
+}
+
+// configSpecs returns the configs of the components command runs, the API's
+// only when it's enabled. Read-only commands only need the settings to reach
+// the database and the chain
+func configSpecs(command string, apiEnabled bool) []any {
+	var indexerConfig any = &indexer.Config{}
+	if commands[command].readOnly {
+		indexerConfig = &indexer.ReaderConfig{}
+	}
+	specs := []any{
+		&Config{},
+		indexerConfig,
+		&tracing.Config{},
+	}
+	if apiEnabled {
+		specs = append(specs, &api.Config{})
+	}
+	return specs
+}
+
+// printConfig writes the effective config to stdout with the secrets masked
+// and exits with a failure if it isn't valid
+func printConfig(specs []any) {
+	err := settings.Print(os.Stdout, specs...)
+	if err != nil {
+		log.Fatalf("Unable to print config: %s", err)
+	}
+	err = settings.Validate(specs...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid config:\n%s\n", err)
+		os.Exit(exitFailure)
+	}
 }
@@ -0,0 +1,3 @@
+// Package settings loads the YAML or TOML config file into the environment,
+// validates the settings of the components and prints the effective config
+package settings
@@ -0,0 +1,361 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/cosmos/btcutil/bech32"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// Validation rules set with the validate tag of a config field
+const (
+	// RuleURL requires an absolute URL
+	RuleURL = "url"
+	// RuleDSN requires a Postgres DSN, as a URL or key=value pairs
+	RuleDSN = "dsn"
+	// RuleContract requires a bech32 Neutron contract address
+	RuleContract = "contract"
+	// RuleJSON requires a JSON object, ie. a contract query message
+	RuleJSON = "json"
+	// RuleQuery requires a contract query message as a JSON object, or the
+	// absolute REST URL of a smart query, the form used before messages
+	RuleQuery = "query"
+)
+
+// contractPrefix and contractLength are the bech32 prefix and byte length of
+// a Neutron contract address
+const (
+	contractPrefix = "neutron"
+	contractLength = 32
+)
+
+// mask replaces the value of a secret setting
+const mask = "****"
+
+// profilesKey is the section of the config file holding the profiles
+const profilesKey = "profiles"
+
+// dsnPassword matches the password of a key=value DSN
+var dsnPassword = regexp.MustCompile(`password=('[^']*'|\S+)`)
+
+// Source is where the settings are loaded from
+type Source struct {
+	// File is the YAML (.yaml, .yml) or TOML (.toml) config file. Without a
+	// file the settings are only read from the environment
+	File string `envconfig:"CONFIG_FILE" required:"false"`
+	// Profile is the section of the config file's profiles applied over its
+	// top-level settings, ie. mainnet or local
+	Profile string `envconfig:"CONFIG_PROFILE" required:"false"`
+}
+
+// setting is a config field of a component
+type setting struct {
+	key      string
+	def      string
+	required bool
+	secret   bool
+	rule     string
+}
+
+// Load reads the config file and the profile named in the environment and
+// sets every setting the environment doesn't set already, so environment
+// variables override the file. specs are the configs of the components, a
+// key in the file that none of them declare is an error
+func Load(specs ...any) error {
+	var source Source
+	err := envconfig.Process("", &source)
+	if err != nil {
+		return err
+	}
+	if source.File == "" {
+		if source.Profile != "" {
+			return fmt.Errorf("profile %q set without a config file", source.Profile)
+		}
+		return nil
+	}
+
+	values, err := read(source.File)
+	if err != nil {
+		return err
+	}
+
+	// Apply the profile over the top-level settings
+	profiles := map[string]any{}
+	if section, ok := values[profilesKey]; ok {
+		profiles, ok = section.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: %s must be a table of profiles", source.File, profilesKey)
+		}
+		delete(values, profilesKey)
+	}
+	if source.Profile != "" {
+		section, ok := profiles[source.Profile]
+		if !ok {
+			return fmt.Errorf("%s: profile %q not found", source.File, source.Profile)
+		}
+		profile, ok := section.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: profile %q must be a table of settings", source.File, source.Profile)
+		}
+		for key, value := range profile {
+			values[key] = value
+		}
+	}
+
+	known := map[string]bool{}
+	for _, field := range fields(specs) {
+		known[field.key] = true
+	}
+
+	var errs []error
+	for key, value := range values {
+		envKey := strings.ToUpper(key)
+		if !known[envKey] {
+			errs = append(errs, fmt.Errorf("%s: unknown setting %q", source.File, key))
+			continue
+		}
+		envValue, err := format(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: setting %q: %v", source.File, key, err))
+			continue
+		}
+		if _, ok := os.LookupEnv(envKey); ok {
+			continue
+		}
+		err = os.Setenv(envKey, envValue)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate checks the settings of specs: required settings must be set, every
+// value must parse into its field and follow the rule of its validate tag.
+// All the failures are returned together
+func Validate(specs ...any) error {
+	var errs []error
+	for _, field := range fields(specs) {
+		value := lookup(field)
+		if value == "" {
+			if field.required {
+				errs = append(errs, fmt.Errorf("%s is required", field.key))
+			}
+			continue
+		}
+		err := check(field.rule, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", field.key, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	// Let envconfig report values that don't parse, ie. a bad duration
+	for _, spec := range specs {
+		err := envconfig.Process("", spec)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Print writes the effective settings of specs to w as YAML, with the values
+// of secret settings masked
+func Print(w io.Writer, specs ...any) error {
+	var source Source
+	err := envconfig.Process("", &source)
+	if err != nil {
+		return err
+	}
+
+	document := &yaml.Node{Kind: yaml.MappingNode}
+	if source.File != "" {
+		document.HeadComment = fmt.Sprintf("file: %s, profile: %s", source.File, source.Profile)
+	}
+	for _, field := range fields(specs) {
+		value := lookup(field)
+		if field.secret {
+			value = maskSecret(field.rule, value)
+		}
+		document.Content = append(document.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: strings.ToLower(field.key)},
+			&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value},
+		)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	err = encoder.Encode(document)
+	if err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// read decodes the config file at path by its extension
+func read(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("%s: unsupported config file type, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return values, nil
+}
+
+// format returns value from the config file as envconfig expects it, lists
+// are joined with commas
+func format(value any) (string, error) {
+	switch value := value.(type) {
+	case nil:
+		return "", nil
+	case []any:
+		items := make([]string, len(value))
+		for i, item := range value {
+			formatted, err := format(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = formatted
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		return "", errors.New("tables aren't supported")
+	default:
+		return fmt.Sprint(value), nil
+	}
+}
+
+// fields returns the settings declared by specs, the first declaration of a
+// key shared by components wins
+func fields(specs []any) []setting {
+	var settings []setting
+	seen := map[string]bool{}
+	for _, spec := range specs {
+		specType := reflect.TypeOf(spec)
+		if specType.Kind() == reflect.Pointer {
+			specType = specType.Elem()
+		}
+		for i := 0; i < specType.NumField(); i++ {
+			field := specType.Field(i)
+			key := field.Tag.Get("envconfig")
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			settings = append(settings, setting{
+				key:      key,
+				def:      field.Tag.Get("default"),
+				required: field.Tag.Get("required") == "true",
+				secret:   field.Tag.Get("secret") == "true",
+				rule:     field.Tag.Get("validate"),
+			})
+		}
+	}
+	return settings
+}
+
+// lookup returns the value of field from the environment, or its default
+func lookup(field setting) string {
+	value, ok := os.LookupEnv(field.key)
+	if !ok {
+		return field.def
+	}
+	return value
+}
+
+// check returns an error if value doesn't follow rule
+func check(rule string, value string) error {
+	switch rule {
+	case RuleURL:
+		parsed, err := url.Parse(value)
+		if err != nil {
+			return err
+		}
+		if parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("%q is not an absolute URL", value)
+		}
+	case RuleDSN:
+		_, err := pgconn.ParseConfig(value)
+		if err != nil {
+			// The parse error holds the DSN, password included
+			return errors.New("invalid database DSN")
+		}
+	case RuleJSON:
+		var message map[string]json.RawMessage
+		err := json.Unmarshal([]byte(value), &message)
+		if err != nil {
+			return fmt.Errorf("%q is not a JSON object", value)
+		}
+	case RuleQuery:
+		if check(RuleURL, value) == nil {
+			return nil
+		}
+		var message map[string]json.RawMessage
+		err := json.Unmarshal([]byte(value), &message)
+		if err != nil {
+			return fmt.Errorf("%q is neither a JSON object nor a smart query URL", value)
+		}
+	case RuleContract:
+		prefix, address, err := bech32.DecodeToBase256(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a bech32 address: %v", value, err)
+		}
+		if prefix != contractPrefix || len(address) != contractLength {
+			return fmt.Errorf("%q is not a %s contract address", value, contractPrefix)
+		}
+	}
+	return nil
+}
+
+// maskSecret hides the secret in value. Only the password of DSNs and URLs
+// is hidden, other secrets are hidden entirely
+func maskSecret(rule string, value string) string {
+	if value == "" {
+		return value
+	}
+	switch rule {
+	case RuleDSN, RuleURL:
+		parsed, err := url.Parse(value)
+		if err == nil && parsed.Scheme != "" {
+			if _, ok := parsed.User.Password(); ok {
+				// The mask is written out as is, url.UserPassword would
+				// escape it
+				user := url.User(parsed.User.Username()).String()
+				parsed.User = nil
+				return strings.Replace(parsed.String(), "//", "//"+user+":"+mask+"@", 1)
+			}
+			return parsed.String()
+		}
+		if rule == RuleDSN {
+			return dsnPassword.ReplaceAllString(value, "password="+mask)
+		}
+	}
+	return mask
+}
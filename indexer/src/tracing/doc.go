@@ -0,0 +1,3 @@
+// Package tracing sets up the OpenTelemetry tracer provider used by the
+// indexer
+package tracing
@@ -0,0 +1,81 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporters the traces can be sent to
+const (
+	// ExporterNone disables tracing
+	ExporterNone = "none"
+	// ExporterOTLP sends the traces to an OTLP collector over HTTP
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes the traces to stdout for development
+	ExporterStdout = "stdout"
+)
+
+type Config struct {
+	Exporter string `envconfig:"TRACING_EXPORTER" default:"none"`
+	// Endpoint of the OTLP collector, ie. localhost:4318. If not set, the
+	// standard OTEL_EXPORTER_OTLP_ENDPOINT environment variable is used
+	Endpoint string  `envconfig:"TRACING_ENDPOINT" required:"false"`
+	Insecure bool    `envconfig:"TRACING_INSECURE" required:"false"`
+	Ratio    float64 `envconfig:"TRACING_SAMPLE_RATIO" default:"1"`
+}
+
+// Setup installs the global tracer provider for the configured exporter and
+// returns the function flushing and stopping it. Without an exporter the
+// no-op provider stays in place
+func Setup(serviceName string) (func(context.Context) error, error) {
+	var config Config
+	err := envconfig.Process("", &config)
+	if err != nil {
+		return nil, err
+	}
+
+	var exporter sdktrace.SpanExporter
+	switch strings.ToLower(config.Exporter) {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		var options []otlptracehttp.Option
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(
+			stdouttrace.WithWriter(os.Stdout),
+			stdouttrace.WithPrettyPrint(),
+		)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.Ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}